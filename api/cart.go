@@ -6,6 +6,8 @@ import (
 	"fmt"
 )
 
+// CreateServerCart puts servers in a cart, a new one unless cart.CartOID is set,
+// and returns the cart OID
 func (API *API) CreateServerCart(cart *AddServerCart) (string, error) {
 	path := fmt.Sprintf("/cart/server")
 	rawData, apiReturn, err := API.SendRequestToAPI(HTTPPost, path, cart)
@@ -48,3 +48,21 @@ func (API *API) RemoveNetwork(networkOID string) error {
 	_, apiReturn, err := API.SendRequestToAPI(HTTPDelete, "/network/switch/"+networkOID, nil)
 	return handleError(apiReturn, err)
 }
+
+func (API *API) NetworkAttachServers(networkOID string, serverOIDs []string) (*Return, error) {
+	req := NetworkOps{ServerOIDs: serverOIDs}
+	_, apiReturn, err := API.SendRequestToAPI(HTTPPut, "/network/switch/"+networkOID+"/attach", req)
+	return apiReturn, err
+}
+
+func (API *API) NetworkDetachServer(networkOID, serverOID string) (*Return, error) {
+	req := NetworkOps{ServerOID: serverOID}
+	_, apiReturn, err := API.SendRequestToAPI(HTTPPut, "/network/switch/"+networkOID+"/detach", req)
+	return apiReturn, err
+}
+
+func (API *API) NetworkRename(networkOID, name string) (*Return, error) {
+	req := NetworkRename{Name: name}
+	_, apiReturn, err := API.SendRequestToAPI(HTTPPut, "/network/switch/"+networkOID, req)
+	return apiReturn, err
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 )
 
@@ -16,13 +17,28 @@ func (API *API) ServerChangeName(newServerName, serverOID string) (*Return, erro
 	return apiReturn, err
 }
 
+// ServerActiveStates are the server states listed by default (deleted servers are excluded)
+var ServerActiveStates = []string{"started", "stopped", "starting", "stopping", "creating", "unmanaged"}
+
 func (API *API) ServerList(companyOID string) ([]ServerDetail, *Return, error) {
 	// Filter to show only active servers (exclude deleted)
+	return API.ServerListByStates(companyOID, ServerActiveStates)
+}
+
+// ServerListByStates lists the servers of a company whose state is one of states.
+// The filter is applied by the API; with no state, servers of any state are returned.
+func (API *API) ServerListByStates(companyOID string, states []string) ([]ServerDetail, *Return, error) {
 	// Array format uses bracket notation: states[]=value
-	activeStates := "states[]=started&states[]=stopped&states[]=starting&states[]=stopping&states[]=creating&states[]=unmanaged"
-	path := "/server?" + activeStates
+	var params []string
+	for _, state := range states {
+		params = append(params, "states[]="+url.QueryEscape(state))
+	}
 	if companyOID != "" {
-		path = "/server?" + activeStates + "&company_oid=" + companyOID
+		params = append(params, "company_oid="+url.QueryEscape(companyOID))
+	}
+	path := "/server"
+	if len(params) > 0 {
+		path += "?" + strings.Join(params, "&")
 	}
 	rawData, apiReturn, err := API.SendRequestToAPI(HTTPGet, path, nil)
 	// Communication error
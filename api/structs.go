@@ -655,8 +655,10 @@ type IPUpdateRequest struct {
 	Reverse string `json:"reverse"`
 }
 
+// AddServerCart is the request body for POST /cart/server. Without CartOID, the
+// servers are put in a new cart.
 type AddServerCart struct {
-	CartOID  string              `json:"cart_oid"`
+	CartOID  string              `json:"cart_oid,omitempty"`
 	Quantity int                 `json:"quantity,omitempty"`
 	Items    []AddServerCartItem `json:"items"`
 	Auth     ItemCartAuth        `json:"auth,omitempty"`
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"titan-sc/run"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func (cmd *CMD) BudgetCmdAdd() {
+	budget := &cobra.Command{
+		Use:   "budget",
+		Short: "Limit and audit server purchases.",
+		Long: `Limit the server orders of the profile and audit purchase attempts.
+
+Orders are priced before payment and refused when they exceed the budget: maximum
+price TTC per order and maximum number of servers per order. Commands ordering
+several servers ('server create -f', 'apply') count them as one order. Use
+--override-budget on the ordering command to go over it.
+
+Every purchase attempt, blocked or not, is recorded with its amount in the purchase
+log next to the configuration file.`,
+		GroupID: "config",
+	}
+
+	budgetShow := &cobra.Command{
+		Use:   "show",
+		Short: "Show the budget of the profile.",
+		Run:   cmd.runMiddleware.BudgetShow,
+	}
+
+	budgetSet := &cobra.Command{
+		Use:   "set [--max-order-ttc AMOUNT] [--max-servers-per-order N]",
+		Short: "Set the budget of the profile (0 removes a limit).",
+		Example: `  titan-sc budget set --max-order-ttc 500 --max-servers-per-order 3
+  titan-sc budget set --max-order-ttc 0`,
+		Run: cmd.budgetSet,
+	}
+
+	budgetLog := &cobra.Command{
+		Use:   "log",
+		Short: "List the recorded purchase attempts.",
+		Run:   cmd.runMiddleware.BudgetLog,
+	}
+
+	budget.AddCommand(budgetShow, budgetSet, budgetLog)
+	cmd.RootCommand.AddCommand(budget)
+
+	budgetSet.Flags().Float64("max-order-ttc", 0, "Maximum price of an order, tax included, in currency units.")
+	budgetSet.Flags().Int("max-servers-per-order", 0, "Maximum number of servers per order.")
+	budgetSet.MarkFlagsOneRequired("max-order-ttc", "max-servers-per-order")
+	budgetLog.Flags().IntP("limit", "n", 20, "Number of most recent attempts to list (0 for all).")
+}
+
+func (cmd *CMD) budgetSet(cobraCommand *cobra.Command, args []string) {
+	_ = args
+	cmd.runMiddleware.ParseGlobalFlags(cobraCommand)
+
+	if cobraCommand.Flags().Changed("max-order-ttc") {
+		value, _ := cobraCommand.Flags().GetFloat64("max-order-ttc")
+		if value < 0 {
+			cmd.runMiddleware.OutputErrorAndExit(fmt.Errorf("--max-order-ttc must be positive"))
+		}
+		viper.Set("default.budget.max_order_ttc", value)
+	}
+	if cobraCommand.Flags().Changed("max-servers-per-order") {
+		value, _ := cobraCommand.Flags().GetInt("max-servers-per-order")
+		if value < 0 {
+			cmd.runMiddleware.OutputErrorAndExit(fmt.Errorf("--max-servers-per-order must be positive"))
+		}
+		viper.Set("default.budget.max_servers_per_order", value)
+	}
+
+	if err := os.MkdirAll(run.ConfigDir(), 0700); err != nil {
+		cmd.runMiddleware.OutputErrorAndExit(fmt.Errorf("failed to create config directory: %w", err))
+	}
+	viper.SetConfigType("toml")
+	if err := viper.WriteConfigAs(getConfigPath()); err != nil {
+		cmd.runMiddleware.OutputErrorAndExit(err)
+	}
+	if !cmd.runMiddleware.JSONOutput {
+		fmt.Printf("%s budget saved to %s\n", cmd.runMiddleware.Colorize("Success:", "green"), getConfigPath())
+	}
+	cmd.runMiddleware.Budget.MaxOrderTTC = int64(math.Round(viper.GetFloat64("default.budget.max_order_ttc") * 100))
+	cmd.runMiddleware.Budget.MaxServersPerOrder = viper.GetInt("default.budget.max_servers_per_order")
+	cmd.runMiddleware.BudgetShow(cobraCommand, args)
+}
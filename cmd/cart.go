@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func (cmd *CMD) CartCmdAdd() {
+	cart := &cobra.Command{
+		Use:   "cart",
+		Short: "Assemble and buy a multi-item order.",
+		Long: `Assemble an order of several items, review its total and buy it at once.
+
+The cart holds new servers. It is kept in a local file next to the configuration
+file until it is bought, so it can be built over several commands. Passwords are never stored: servers need SSH keys, except
+Windows servers.`,
+		Example: `  titan-sc cart add-server --plan SC1 --template-oid TPL --ssh-keys-name admin --quantity 3
+  titan-sc cart price
+  titan-sc cart buy --confirm-payment`,
+		GroupID: "resources",
+	}
+
+	cartShow := &cobra.Command{
+		Use:   "show",
+		Short: "List the items of the cart.",
+		Run:   cmd.runMiddleware.CartShow,
+	}
+
+	cartAddServer := &cobra.Command{
+		Use:   "add-server --plan PLAN --template-oid OID",
+		Short: "Add servers to the cart.",
+		Run:   cmd.runMiddleware.CartAddServer,
+	}
+
+	cartRemove := &cobra.Command{
+		Use:   "remove INDEX...",
+		Short: "Remove items from the cart, by index as listed by 'cart show'.",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   cmd.runMiddleware.CartRemove,
+	}
+
+	cartClear := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove all items from the cart.",
+		Run:   cmd.runMiddleware.CartClear,
+	}
+
+	cartPrice := &cobra.Command{
+		Use:   "price",
+		Short: "Price each item of the cart and the total.",
+		Run:   cmd.runMiddleware.CartPrice,
+	}
+
+	cartBuy := &cobra.Command{
+		Use:   "buy --confirm-payment",
+		Short: "Buy the whole cart.",
+		Long: `Buy the whole cart with one payment method and subscription.
+
+All the items are put in a single order, priced and checked against the budget of
+the profile, then paid at once. The cart is emptied once bought: if the purchase
+fails, nothing is bought and the cart is unchanged.`,
+		Run: cmd.runMiddleware.CartBuy,
+	}
+
+	cart.AddCommand(cartShow, cartAddServer, cartRemove, cartClear, cartPrice, cartBuy)
+	cmd.RootCommand.AddCommand(cart)
+
+	cartAddServer.Flags().StringP("plan", "p", "", "Server plan (SC1, SC2, SC3).")
+	cartAddServer.Flags().StringP("template-oid", "t", "", "Template OID for the OS.")
+	cartAddServer.Flags().StringP("ssh-keys-name", "", "", "SSH keys: keyname1,keyname2,...,keynameN.")
+	cartAddServer.Flags().IntP("quantity", "", 1, "Number of servers.")
+	cartAddServer.Flags().IntP("cpu", "c", 0, "Total CPU cores (0 = plan default).")
+	cartAddServer.Flags().IntP("ram", "r", 0, "Total RAM in GB (0 = plan default).")
+	cartAddServer.Flags().IntP("disk", "d", 0, "Total disk in GB, must be multiple of 10 (0 = plan default).")
+	_ = cartAddServer.MarkFlagRequired("plan")
+	_ = cartAddServer.MarkFlagRequired("template-oid")
+
+	cartBuy.Flags().String("payment-method", "", "Payment method OID (uses default if not specified).")
+	cartBuy.Flags().String("subscription-oid", "", "Add the items to existing subscription OID (optional, creates new subscription if not set).")
+	cartBuy.Flags().Bool("confirm-payment", false, "Confirm the payment (required to proceed).")
+	cartBuy.Flags().Bool("override-budget", false, "Buy even if the cart exceeds the budget of the profile.")
+	cartBuy.Flags().BoolP("yes", "y", false, "Buy without confirmation prompt.")
+}
@@ -41,11 +41,13 @@ func NewCMD(programName, configFileName string, tokenDefined bool, runMiddleware
 		VersionMinor:   verionsMinor,
 		VersionPatch:   versionPatch,
 	}
-	cmd.RootCommand.PersistentPreRun = cmd.checkTokenRequirement
+	cmd.RootCommand.PersistentPreRunE = cmd.persistentPreRun
 
 	// Define command groups
 	cmd.RootCommand.AddGroup(
 		&cobra.Group{ID: "resources", Title: "Resource Commands:"},
+		&cobra.Group{ID: "fleet", Title: "Fleet Commands:"},
+		&cobra.Group{ID: "manifest", Title: "Manifest Commands:"},
 		&cobra.Group{ID: "config", Title: "Configuration Commands:"},
 	)
 
@@ -122,6 +124,13 @@ func hasJSONFlag(args []string) bool {
 	return false
 }
 
+// persistentPreRun runs before every command: token check, then interactive
+// selection of missing required resource flags
+func (cmd *CMD) persistentPreRun(cobraCommand *cobra.Command, args []string) error {
+	cmd.checkTokenRequirement(cobraCommand, args)
+	return cmd.promptMissingFlags(cobraCommand)
+}
+
 func (cmd *CMD) checkTokenRequirement(cobraCommand *cobra.Command, args []string) {
 	_ = args
 	arrCmd := strings.SplitN(cobraCommand.CommandPath(), " ", 3)
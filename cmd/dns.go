@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"titan-sc/run"
+
+	"github.com/spf13/cobra"
+)
+
+func (cmd *CMD) DNSCmdAdd() {
+	dns := &cobra.Command{
+		Use:     "dns",
+		Short:   "Generate DNS data for your servers.",
+		Long:    "Generate DNS data for your servers.",
+		GroupID: "fleet",
+	}
+
+	dnsZone := &cobra.Command{
+		Use:   "zone --origin DOMAIN [--ptr | --reverse-commands]",
+		Short: "Generate zone records from server names and IPs.",
+		Long: `Generate A and AAAA records named after the servers, for every IP address attached
+to them, relative to --origin.
+
+With --ptr, the matching PTR records are appended (absolute names, to copy into the
+reverse zones). With --reverse-commands, the 'ip reverse set' commands needed to make the
+reverse DNS of the IPs consistent with the zone are printed instead of the zone;
+IPs whose reverse is already correct are skipped.`,
+		Example: `  titan-sc dns zone --origin example.com > db.example.com.titan
+  titan-sc dns zone --origin example.com --selector tag=web --ptr
+  titan-sc dns zone --origin example.com --reverse-commands | sh`,
+		Run: cmd.runMiddleware.DNSZone,
+	}
+
+	dns.AddCommand(dnsZone)
+	cmd.RootCommand.AddCommand(dns)
+
+	dnsZone.Flags().String("origin", "", "Zone origin (e.g. example.com).")
+	dnsZone.Flags().Int("ttl", run.DefaultDNSTTL, "Default TTL of the zone ($TTL).")
+	dnsZone.Flags().Bool("ptr", false, "Also generate the PTR records.")
+	dnsZone.Flags().Bool("reverse-commands", false, "Print the 'ip reverse set' commands matching the zone instead of the zone.")
+	dnsZone.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	dnsZone.Flags().String("selector", "", "Only include servers matching a selector (e.g. \"tag=web\").")
+	_ = dnsZone.MarkFlagRequired("origin")
+	dnsZone.MarkFlagsMutuallyExclusive("ptr", "reverse-commands")
+}
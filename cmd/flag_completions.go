@@ -28,6 +28,7 @@ func (cmd *CMD) RegisterFlagCompletions() {
 	// Contextual completions (behavior depends on command context)
 	cmd.registerIPCompletion()
 	cmd.registerNetworkServerOIDCompletion()
+	cmd.registerServerNameArgCompletion()
 }
 
 // getCompanyOIDForCompletion returns the company OID to use for completion.
@@ -84,6 +85,39 @@ func (cmd *CMD) registerServerOIDCompletion() {
 	registerCompletionRecursive(cmd.RootCommand, "server-oid", completionFunc, networkDetachCmd)
 }
 
+// registerServerNameArgCompletion completes server names: the NAME argument of
+// 'server ssh' and the --to-server flag of 'ip move'
+func (cmd *CMD) registerServerNameArgCompletion() {
+	completionFunc := func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		companyOID := cmd.getCompanyOIDForCompletion(c)
+		if companyOID == "" {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		servers, apiReturn, err := cmd.runMiddleware.API.ServerList(companyOID)
+		if err != nil || apiReturn != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		var completions []string
+		for _, server := range servers {
+			completions = append(completions, fmt.Sprintf("%s\t%s", server.Name, server.OID))
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	if sshCmd := findCommand(cmd.RootCommand, "server", "ssh"); sshCmd != nil {
+		sshCmd.ValidArgsFunction = func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return completionFunc(c, args, toComplete)
+		}
+	}
+	if ipMoveCmd := findCommand(cmd.RootCommand, "ip", "move"); ipMoveCmd != nil {
+		_ = ipMoveCmd.RegisterFlagCompletionFunc("to-server", completionFunc)
+	}
+}
+
 // registerNetworkOIDCompletion registers completion for --network-oid flag
 func (cmd *CMD) registerNetworkOIDCompletion() {
 	completionFunc := func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
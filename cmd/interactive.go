@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"titan-sc/run"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// promptMissingFlags opens the interactive picker for each required resource flag
+// left empty (e.g. --server-oid). Candidates come from the flag completion function
+// registered in flag_completions.go, so only resource flags are concerned.
+// Nothing is prompted when the CLI is not interactive or in JSON mode: cobra then
+// reports the missing flag as usual.
+func (cmd *CMD) promptMissingFlags(c *cobra.Command) error {
+	cmd.runMiddleware.ParseGlobalFlags(c)
+	if !cmd.runMiddleware.IsInteractive() {
+		return nil
+	}
+
+	// Flags are visited in lexical order, so --server-oid is resolved before
+	// dependent flags such as --snapshot-oid.
+	var missing []*pflag.Flag
+	seenGroups := map[string]bool{}
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed && isRequiredFlag(f) {
+			missing = append(missing, f)
+		}
+		// One of a group (e.g. --server-oid, --all, --selector): prompt for the
+		// first flag of the group when none of them is set
+		for _, group := range f.Annotations[oneRequiredAnnotation] {
+			if seenGroups[group] {
+				continue
+			}
+			seenGroups[group] = true
+			if first := firstFlagOfUnsetGroup(c, group); first != nil {
+				missing = append(missing, first)
+			}
+		}
+	})
+
+	for _, f := range missing {
+		completionFunc, ok := c.GetFlagCompletionFunc(f.Name)
+		if !ok {
+			continue
+		}
+		completions, directive := completionFunc(c, nil, "")
+		if directive&cobra.ShellCompDirectiveError != 0 || len(completions) == 0 {
+			continue
+		}
+
+		value, err := cmd.runMiddleware.Pick("Select --"+f.Name, completionsToPickerOptions(completions))
+		if errors.Is(err, run.ErrPickerCancelled) {
+			return err
+		}
+		if err != nil {
+			// Terminal could not be used, let cobra report the missing flag
+			return nil
+		}
+		if err = c.Flags().Set(f.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oneRequiredAnnotation is the annotation set by cobra's MarkFlagsOneRequired
+const oneRequiredAnnotation = "cobra_annotation_one_required"
+
+// firstFlagOfUnsetGroup returns the first flag of a one-required group, or nil
+// if any flag of the group is already set
+func firstFlagOfUnsetGroup(c *cobra.Command, group string) *pflag.Flag {
+	names := strings.Split(group, " ")
+	for _, name := range names {
+		if f := c.Flags().Lookup(name); f == nil || f.Changed {
+			return nil
+		}
+	}
+	return c.Flags().Lookup(names[0])
+}
+
+// isRequiredFlag returns true if the flag was marked with MarkFlagRequired
+func isRequiredFlag(f *pflag.Flag) bool {
+	required, ok := f.Annotations[cobra.BashCompOneRequiredFlag]
+	return ok && len(required) > 0 && required[0] == "true"
+}
+
+// completionsToPickerOptions converts "VALUE\tDESCRIPTION" completions to picker options
+func completionsToPickerOptions(completions []string) []run.PickerOption {
+	options := make([]run.PickerOption, 0, len(completions))
+	for _, completion := range completions {
+		value, description, _ := strings.Cut(completion, "\t")
+		options = append(options, run.PickerOption{Value: value, Description: description})
+	}
+	return options
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"titan-sc/run"
+
+	"github.com/spf13/cobra"
+)
+
+func (cmd *CMD) InventoryCmdAdd() {
+	inventory := &cobra.Command{
+		Use:     "inventory",
+		Aliases: []string{"inv"},
+		Short:   "Generate inventories of your servers for other tools.",
+		Long:    "Generate inventories of your servers for other tools.",
+		GroupID: "fleet",
+	}
+
+	inventoryAnsible := &cobra.Command{
+		Use:   "ansible {--list | --host HOST} [--company-oid COMPANY_OID] [--selector SELECTOR]",
+		Short: "Ansible dynamic inventory.",
+		Long: `Ansible dynamic inventory, following the --list / --host protocol.
+
+Hosts are named after the servers and connect to the primary IP address with the
+server login (ansible_host, ansible_user). Other facts are available as titan_*
+variables (OIDs, plan, OS, site, state, DRP, tags, IPs, private networks).
+
+Groups are derived from the servers:
+  plan_<plan>, os_<os>, os_<os>_<version>, site_<site>, tag_<tag>,
+  drp_<enabled|disabled|error>, network_<private network name>
+
+To use it, make an executable script calling this command, e.g. titan.sh:
+  #!/bin/sh
+  exec titan-sc inventory ansible "$@"`,
+		Example: `  titan-sc inventory ansible --list
+  titan-sc inventory ansible --host web-01
+  ansible -i titan.sh tag_web -m ping`,
+		Run: cmd.runMiddleware.InventoryAnsible,
+	}
+
+	inventoryPrometheusSD := &cobra.Command{
+		Use:   "prometheus-sd [--port PORT] [--output FILE [--watch]]",
+		Short: "Prometheus file-based service discovery.",
+		Long: `Generate a Prometheus file_sd file with a target group per server.
+
+Targets are the primary IP address of the servers on each --port (node exporter
+by default). Labels: titan_name, titan_oid, titan_plan, titan_site and titan_tags
+(comma-separated with surrounding commas, e.g. ",web,prod,").
+
+With --output, the file is replaced atomically and only when its content changes.
+With --watch, the servers are fetched again every --interval.`,
+		Example: `  titan-sc inventory prometheus-sd --output /etc/prometheus/titan.json
+  titan-sc inventory prometheus-sd --port 9100,9113 --selector tag=web --output titan-web.json --watch`,
+		Run: cmd.runMiddleware.InventoryPrometheusSD,
+	}
+
+	inventoryHosts := &cobra.Command{
+		Use:   "hosts [--domain DOMAIN] [--output FILE [--watch]]",
+		Short: "/etc/hosts entries for your servers.",
+		Long: `Generate /etc/hosts entries mapping the primary IP address of each server to its name.
+
+With --output, the entries are written into a block delimited by markers: everything
+outside of the block is left untouched, so --output /etc/hosts is safe. The file is
+replaced atomically and only when the entries change.
+With --watch, the servers are fetched again every --interval.`,
+		Example: `  titan-sc inventory hosts --domain titan.example.com
+  sudo titan-sc inventory hosts --ipv6 --output /etc/hosts --watch`,
+		Run: cmd.runMiddleware.InventoryHosts,
+	}
+
+	inventory.AddCommand(inventoryAnsible, inventoryPrometheusSD, inventoryHosts)
+	cmd.RootCommand.AddCommand(inventory)
+
+	inventoryAnsible.Flags().Bool("list", false, "Print all groups and hosts.")
+	inventoryAnsible.Flags().String("host", "", "Print the variables of a host.")
+	inventoryAnsible.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	inventoryAnsible.Flags().String("selector", "", "Only include servers matching a selector (e.g. \"state=started\").")
+	inventoryAnsible.MarkFlagsOneRequired("list", "host")
+	inventoryAnsible.MarkFlagsMutuallyExclusive("list", "host")
+
+	inventoryPrometheusSD.Flags().IntSlice("port", []int{run.DefaultPrometheusPort}, "Port(s) to scrape on each server.")
+	inventoryHosts.Flags().String("domain", "", "Domain appended to server names (the short name is kept as alias).")
+	inventoryHosts.Flags().Bool("ipv6", false, "Also add entries for the primary IPv6 addresses.")
+	for _, c := range []*cobra.Command{inventoryPrometheusSD, inventoryHosts} {
+		c.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+		c.Flags().String("selector", "", "Only include servers matching a selector (e.g. \"state=started\").")
+		c.Flags().StringP("output", "o", "", "File to write (prints to stdout if not specified).")
+		c.Flags().BoolP("watch", "w", false, "Keep running and rewrite the file when servers change (requires --output).")
+		c.Flags().Duration("interval", run.DefaultInventoryWatchInterval, "Refresh interval with --watch.")
+	}
+}
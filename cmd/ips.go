@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"titan-sc/run"
+
 	"github.com/spf13/cobra"
 )
 
@@ -13,21 +15,80 @@ func (cmd *CMD) IpCmdAdd() {
 	}
 
 	listCompanyAvailableIPs := &cobra.Command{
-		Use:     "list [--company-oid COMPANY_OID]",
+		Use:     "list [--company-oid COMPANY_OID] [--attached | --unattached] [--server SERVER] [--version 4|6]",
 		Aliases: []string{"ls"},
-		Short:   "List available IPs on a company.",
-		Long: `List all available IPs (not attached to a server) on a company.
+		Short:   "List the IPs of a company.",
+		Long: `List the IPs of a company, attached to a server or not.
+
+If --company-oid is not specified, your default company will be used.
+IPv6 addresses are shown in their canonical (compressed) form.
 
-If --company-oid is not specified, your default company will be used.`,
+--by-server groups the IPs by server, and --summary only counts them (the API does
+not expose an IP quota, so the summary is a count of the IPs the company owns).`,
+		Example: `  titan-sc ip list --unattached --version 4
+  titan-sc ip list --server web-01
+  titan-sc ip list --by-server
+  titan-sc ip list --summary -j`,
 		Run: cmd.runMiddleware.IPsCompanyList,
 	}
 
+	ipReverse := &cobra.Command{
+		Use:   "reverse",
+		Short: "Manage IP reverses.",
+		Long: `Manage the reverse DNS of IPs.
+
+'ip reverse --ip IP --reverse REVERSE' is deprecated, use 'ip reverse set' instead.`,
+		Run: cmd.runMiddleware.IPReverse,
+	}
+
 	ipUpdateReverse := &cobra.Command{
-		Use:   "reverse --ip IP --reverse REVERSE",
+		Use:   "set --ip IP --reverse REVERSE",
 		Short: "Change IP reverse.",
-		Long:  "Change IP reverse.",
-		Run:   cmd.runMiddleware.IPUpdateReverse,
+		Long: `Change IP reverse.
+
+If --company-oid is not specified, the IP is searched in your default company.
+Use 'ip reverse apply' to change many reverses at once.`,
+		Run: cmd.runMiddleware.IPUpdateReverse,
+	}
+
+	ipReverseApply := &cobra.Command{
+		Use:   "apply {-f FILE | --pattern PATTERN} [--dry-run]",
+		Short: "Change many IP reverses at once.",
+		Long: `Change the reverse DNS of many IPs at once.
+
+Desired reverses come either from a file (-f) or from a pattern (--pattern):
+  - CSV file: "ip,reverse" per line, an optional header line and # comments
+  - YAML or JSON file: a list of {ip: ..., reverse: ...} or a map of ip: reverse
+  - Pattern: applied to every IP attached to a server (restricted with --selector),
+    with placeholders {server}, {site}, {plan}, {oid} and {ip} (e.g. 203-0-113-10)
+
+The current and desired reverses are compared and only the differences are shown
+and applied, after confirmation (skip with --yes). Use --dry-run to only show them.`,
+		Example: `  titan-sc ip reverse apply -f reverses.csv --dry-run
+  titan-sc ip reverse apply -f reverses.yaml --company-oid 5f1e... --yes
+  titan-sc ip reverse apply --pattern '{server}.{site}.example.com'
+  titan-sc ip reverse apply --pattern 'ip-{ip}.example.com' --selector tag=web`,
+		Run: cmd.runMiddleware.IPReverseApply,
+	}
+
+	ipReverseCheck := &cobra.Command{
+		Use:   "check [--ip IP]... [--resolver HOST[:PORT]]",
+		Short: "Check that IP reverses resolve back to their IP.",
+		Long: `Check the reverse DNS of IPs (forward-confirmed reverse DNS).
+
+The reverse of each IP is resolved, and the IP is flagged when:
+  - it has no reverse (no_reverse) or still has its default reverse (default_reverse)
+  - its reverse does not resolve (unresolved)
+  - its reverse resolves, but not to the IP (mismatch)
+
+All IPs attached to a server are checked, unless --ip is given. The system resolver
+is used unless --resolver is given. Exits with a non-zero status if any IP is flagged.`,
+		Example: `  titan-sc ip reverse check
+  titan-sc ip reverse check --ip 203.0.113.10 --resolver 1.1.1.1
+  titan-sc ip reverse check --include-unattached -j`,
+		Run: cmd.runMiddleware.IPReverseCheck,
 	}
+	ipReverse.AddCommand(ipUpdateReverse, ipReverseApply, ipReverseCheck)
 
 	ipDetach := &cobra.Command{
 		Use:     "detach --server-oid SERVER_OID --ip IP_ADDRESS",
@@ -45,23 +106,82 @@ If --company-oid is not specified, your default company will be used.`,
 		Run:     cmd.runMiddleware.IPAttach,
 	}
 
+	ipMove := &cobra.Command{
+		Use:   "move --ip IP_ADDRESS --to-server SERVER",
+		Short: "Move an IP to another server.",
+		Long: `Move an IP to another server (name or OID).
+
+The current server of the IP is detached, the IP is attached to the target server
+and the move is verified. If the attach or the verification fails, the IP is
+attached back to its original server so that it is never left orphaned.`,
+		Example: `  titan-sc ip move --ip 203.0.113.50 --to-server web-02
+  titan-sc ip move --ip 2001:db8::50 --to-server 5f1e... --yes`,
+		Run: cmd.runMiddleware.IPMove,
+	}
+
 	cmd.RootCommand.AddCommand(ip)
-	ip.AddCommand(listCompanyAvailableIPs, ipDetach, ipAttach, ipUpdateReverse)
+	ip.AddCommand(listCompanyAvailableIPs, ipDetach, ipAttach, ipMove, ipReverse)
 
 	listCompanyAvailableIPs.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	listCompanyAvailableIPs.Flags().Bool("attached", false, "Only list IPs attached to a server.")
+	listCompanyAvailableIPs.Flags().Bool("unattached", false, "Only list IPs not attached to a server.")
+	listCompanyAvailableIPs.Flags().String("server", "", "Only list IPs attached to a server (name or OID).")
+	listCompanyAvailableIPs.Flags().Int("version", 0, "Only list IPv4 (4) or IPv6 (6) addresses.")
+	listCompanyAvailableIPs.Flags().Bool("by-server", false, "Group IPs by server.")
+	listCompanyAvailableIPs.Flags().Bool("summary", false, "Only show IP counts.")
+	listCompanyAvailableIPs.MarkFlagsMutuallyExclusive("attached", "unattached")
+	listCompanyAvailableIPs.MarkFlagsMutuallyExclusive("unattached", "server")
+	listCompanyAvailableIPs.MarkFlagsMutuallyExclusive("by-server", "summary")
+	_ = listCompanyAvailableIPs.RegisterFlagCompletionFunc("version", cobra.FixedCompletions([]string{"4", "6"}, cobra.ShellCompDirectiveNoFileComp))
 
 	ipDetach.Flags().StringP("server-oid", "s", "", "Set server OID.")
 	ipDetach.Flags().StringP("ip", "i", "", "Set IP to detach.")
 	_ = ipDetach.MarkFlagRequired("server-oid")
 	_ = ipDetach.MarkFlagRequired("ip")
+	ipDetach.Flags().StringP("company-oid", "c", "", "Company OID of the IP (uses your default company if not specified).")
 
 	ipAttach.Flags().StringP("server-oid", "s", "", "Set server OID.")
 	ipAttach.Flags().StringP("ip", "i", "", "Set IP to attach.")
 	_ = ipAttach.MarkFlagRequired("server-oid")
 	_ = ipAttach.MarkFlagRequired("ip")
+	ipAttach.Flags().StringP("company-oid", "c", "", "Company OID of the IP (uses your default company if not specified).")
+
+	ipMove.Flags().StringP("ip", "i", "", "IP to move.")
+	ipMove.Flags().String("to-server", "", "Target server name or OID.")
+	ipMove.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	ipMove.Flags().Duration("timeout", run.DefaultIPMoveTimeout, "Maximum time to wait for the IP to be attached to the target server.")
+	ipMove.Flags().BoolP("yes", "y", false, "Do not ask for confirmation.")
+	_ = ipMove.MarkFlagRequired("ip")
+	_ = ipMove.MarkFlagRequired("to-server")
 
 	ipUpdateReverse.Flags().StringP("ip", "i", "", "Set IP address.")
 	ipUpdateReverse.Flags().StringP("reverse", "r", "", "Set new IP reverse.")
 	_ = ipUpdateReverse.MarkFlagRequired("ip")
 	_ = ipUpdateReverse.MarkFlagRequired("reverse")
+	ipUpdateReverse.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+
+	// Flags of the deprecated 'ip reverse --ip IP --reverse REVERSE'
+	ipReverse.Flags().StringP("ip", "i", "", "Set IP address.")
+	ipReverse.Flags().StringP("reverse", "r", "", "Set new IP reverse.")
+	ipReverse.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	for _, name := range []string{"ip", "reverse", "company-oid"} {
+		_ = ipReverse.Flags().MarkDeprecated(name, "use 'ip reverse set'")
+	}
+
+	ipReverseApply.Flags().StringP("file", "f", "", "CSV, YAML or JSON file of desired reverses.")
+	ipReverseApply.Flags().String("pattern", "", "Reverse pattern for IPs attached to servers (e.g. '{server}.{site}.example.com').")
+	ipReverseApply.Flags().String("selector", "", "With --pattern, only change IPs of servers matching a selector.")
+	ipReverseApply.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	ipReverseApply.Flags().Bool("dry-run", false, "Only show the differences, change nothing.")
+	ipReverseApply.Flags().BoolP("yes", "y", false, "Do not ask for confirmation.")
+	ipReverseApply.MarkFlagsOneRequired("file", "pattern")
+	ipReverseApply.MarkFlagsMutuallyExclusive("file", "pattern")
+	ipReverseApply.MarkFlagsMutuallyExclusive("file", "selector")
+
+	ipReverseCheck.Flags().StringSlice("ip", nil, "IP to check (can be repeated), all IPs attached to a server otherwise.")
+	ipReverseCheck.Flags().Bool("include-unattached", false, "Also check IPs not attached to a server.")
+	ipReverseCheck.Flags().String("resolver", "", "DNS server to query (HOST or HOST:PORT), the system resolver otherwise.")
+	ipReverseCheck.Flags().Duration("timeout", run.DefaultReverseCheckTimeout, "Maximum duration of each lookup.")
+	ipReverseCheck.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	ipReverseCheck.MarkFlagsMutuallyExclusive("ip", "include-unattached")
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"titan-sc/run"
+
+	"github.com/spf13/cobra"
+)
+
+func (cmd *CMD) ManifestCmdAdd() {
+	plan := &cobra.Command{
+		Use:   "plan -f FILE",
+		Short: "Preview the changes needed to match a manifest.",
+		Long: `Compare a manifest (YAML or JSON) describing servers, private networks, IP
+attachments and reverses, SSH keys and network DRP with the live state of the company,
+and print the ordered list of changes 'apply' would make. Nothing is changed.
+
+Servers, networks and SSH keys are matched by OID when set, by name otherwise.
+Resources not listed in the manifest are left untouched, except network members:
+the servers of a network are exactly those it lists. Differences 'apply' cannot fix
+(plan, resources, operating system) are reported as unsupported.`,
+		Example: `  titan-sc plan -f infra.yaml
+  titan-sc plan -f infra.yaml --company-oid COMPANY_OID --json`,
+		GroupID: "manifest",
+		Run:     cmd.runMiddleware.ManifestPlanCmd,
+	}
+
+	apply := &cobra.Command{
+		Use:   "apply -f FILE [--confirm-payment]",
+		Short: "Apply a manifest to the company.",
+		Long: `Compute the same plan as 'plan', ask for confirmation and run the changes in
+order: SSH keys, networks, servers, network members, network DRP, IP attachments and
+reverses. Ordered servers are waited for until started, then named. Apply stops at the
+first failure; running it again resumes from the live state.
+
+Ordering servers requires --confirm-payment. Disabling network DRP requires
+--yes-i-understand-network-will-be-unavailable.`,
+		Example: `  titan-sc apply -f infra.yaml
+  titan-sc apply -f infra.yaml --confirm-payment --yes`,
+		GroupID: "manifest",
+		Run:     cmd.runMiddleware.ManifestApply,
+	}
+
+	export := &cobra.Command{
+		Use:   "export [--format yaml|json]",
+		Short: "Export the live state of the company as a manifest.",
+		Long: `Print the servers, private networks and their members, IP attachments and reverses,
+SSH keys and DRP settings of the company as a manifest, in a canonical order (by name,
+IPs by address) so that exports can be diffed, reviewed and used as the baseline for
+'plan' and 'apply'.
+
+Resources keep their OID, so that 'apply' matches them even after a rename. SSH keys
+installed on the servers and unattached IPs are not exported.`,
+		Example: `  titan-sc export > infra.yaml
+  titan-sc export --company-oid COMPANY_OID --format json > state.json`,
+		GroupID: "manifest",
+		Run:     cmd.runMiddleware.ManifestExport,
+	}
+
+	drift := &cobra.Command{
+		Use:     "drift",
+		Short:   "Detect changes made since an export.",
+		Long:    "Detect changes made since an export.",
+		GroupID: "manifest",
+	}
+
+	driftCheck := &cobra.Command{
+		Use:   "check --baseline FILE",
+		Short: "Compare the live state with a baseline exported by 'export'.",
+		Long: `Compare the live state of the company with a baseline saved by 'export' (YAML or
+JSON), and report added or removed servers, networks and SSH keys, changed server names,
+plans and resources, IP attachments and reverses, network members and DRP status.
+
+Exits with status 2 when anything drifted, so that a scheduled job can alert on changes
+made out of band, with status 1 on errors and 0 when nothing drifted.`,
+		Example: `  titan-sc export --format json > state.json
+  titan-sc drift check --baseline state.json
+  titan-sc drift check --baseline state.json --json`,
+		Run: cmd.runMiddleware.DriftCheck,
+	}
+
+	drift.AddCommand(driftCheck)
+	cmd.RootCommand.AddCommand(plan, apply, export, drift)
+
+	for _, c := range []*cobra.Command{plan, apply} {
+		c.Flags().StringP("file", "f", "", "Manifest file, YAML or JSON (\"-\" for stdin).")
+		c.Flags().StringP("company-oid", "c", "", "Company OID (uses the manifest company_oid or your default company if not specified).")
+		_ = c.MarkFlagRequired("file")
+	}
+	export.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	export.Flags().String("format", run.ManifestFormatYAML, "Output format: yaml or json.")
+	driftCheck.Flags().StringP("baseline", "b", "", "Baseline exported by 'export' (\"-\" for stdin).")
+	driftCheck.Flags().StringP("company-oid", "c", "", "Company OID (uses the baseline company_oid or your default company if not specified).")
+	_ = driftCheck.MarkFlagRequired("baseline")
+	apply.Flags().Bool("confirm-payment", false, "Confirm the payment of the servers the plan orders.")
+	apply.Flags().Bool("override-budget", false, "Order servers even if the orders exceed the budget of the profile.")
+	apply.Flags().String("payment-method", "", "Payment method OID (uses default if not specified).")
+	apply.Flags().String("subscription-oid", "", "Add ordered servers to existing subscription OID (optional).")
+	apply.Flags().Duration("timeout", run.DefaultProvisionTimeout, "Maximum time to wait for each ordered server.")
+	apply.Flags().BoolP("yes", "y", false, "Apply without confirmation prompt.")
+	apply.Flags().Bool("yes-i-understand-network-will-be-unavailable", false, "Confirm that disabling network DRP breaks private network connectivity on the recovery site.")
+}
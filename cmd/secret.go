@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// addSecretFlags adds the safe alternatives to a secret flag --NAME, which shows
+// in shell history and process listings: --NAME-stdin and --NAME-file and, with
+// generate, --generate-NAME and --NAME-output. They are read with run.ReadSecretFlag.
+func addSecretFlags(c *cobra.Command, name string, generate bool) {
+	c.Flags().Bool(name+"-stdin", false, "Read the "+name+" from stdin.")
+	c.Flags().String(name+"-file", "", "Read the "+name+" from a file.")
+	exclusive := []string{name, name + "-stdin", name + "-file"}
+	if generate {
+		c.Flags().Bool("generate-"+name, false, "Generate a strong random "+name+", printed once on stderr.")
+		c.Flags().String(name+"-output", "", "Write the generated "+name+" to a new file, readable only by you (with --generate-"+name+").")
+		exclusive = append(exclusive, "generate-"+name)
+	}
+	c.MarkFlagsMutuallyExclusive(exclusive...)
+}
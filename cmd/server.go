@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"titan-sc/api"
+	"titan-sc/run"
+
 	"github.com/spf13/cobra"
 )
 
@@ -14,12 +17,20 @@ func (cmd *CMD) ServerCmdAdd() {
 	}
 
 	serverList := &cobra.Command{
-		Use:     "list [--company-oid COMPANY_OID]",
+		Use:     "list [--company-oid COMPANY_OID] [filters]",
 		Aliases: []string{"ls"},
 		Short:   "List all servers.",
 		Long: `List all servers within your company.
 
-If --company-oid is not specified, your default company will be used.`,
+If --company-oid is not specified, your default company will be used.
+
+Filters are combined (AND). Filters accepting a list match any of the given values
+(e.g. --state started,stopped). Deleted servers are only listed with --include-deleted
+or --state deleted.`,
+		Example: `  titan-sc server list --state stopped --plan SC2
+  titan-sc server list --name '^web-[0-9]+$' --site main --tag production
+  titan-sc server list --drp error
+  titan-sc server list --os 'debian*' --include-deleted`,
 		Run: cmd.runMiddleware.ServerList,
 	}
 
@@ -32,32 +43,95 @@ If --company-oid is not specified, your default company will be used.`,
 	}
 
 	serverStart := &cobra.Command{
-		Use:   "start --server-oid SERVER_OID",
+		Use:   "start {--server-oid SERVER_OID... | --all | --selector SELECTOR}",
 		Short: "Start a server.",
-		Long:  "Start a stopped server.",
-		Run:   cmd.runMiddleware.ServerStart,
+		Long: `Start a stopped server.
+
+Several servers can be targeted at once with a repeated --server-oid, --all or
+--selector. The list of servers is displayed for confirmation (skip with --yes).`,
+		Example: `  titan-sc server start --server-oid sc-abc123
+  titan-sc server start --selector "name=web-*,state=stopped" --yes`,
+		Run: cmd.runMiddleware.ServerStart,
 	}
 
 	serverStop := &cobra.Command{
-		Use:   "stop --server-oid SERVER_OID",
+		Use:   "stop {--server-oid SERVER_OID... | --all | --selector SELECTOR}",
 		Short: "Stop a server.",
-		Long:  "Gracefully stop a running server (sends ACPI shutdown signal).",
-		Run:   cmd.runMiddleware.ServerStop,
+		Long: `Gracefully stop a running server (sends ACPI shutdown signal).
+
+Several servers can be targeted at once with a repeated --server-oid, --all or
+--selector. The list of servers is displayed for confirmation (skip with --yes).`,
+		Example: `  titan-sc server stop --server-oid sc-abc123
+  titan-sc server stop --selector "name=web-*,state=started" --yes`,
+		Run: cmd.runMiddleware.ServerStop,
 	}
 
 	serverRestart := &cobra.Command{
-		Use:     "restart --server-oid SERVER_OID",
+		Use:     "restart {--server-oid SERVER_OID... | --all | --selector SELECTOR}",
 		Aliases: []string{"reboot"},
 		Short:   "Restart a server.",
-		Long:    "Gracefully restart a server (sends ACPI reboot signal).",
-		Run:     cmd.runMiddleware.ServerRestart,
+		Long: `Gracefully restart a server (sends ACPI reboot signal).
+
+Several servers can be targeted at once with a repeated --server-oid, --all or
+--selector. The list of servers is displayed for confirmation (skip with --yes).`,
+		Example: `  titan-sc server restart --server-oid sc-abc123 --wait
+  titan-sc server restart --selector "tag=web" --parallel 2 --wait --yes`,
+		Run: cmd.runMiddleware.ServerRestart,
 	}
 
 	serverHardstop := &cobra.Command{
-		Use:   "hardstop --server-oid SERVER_OID",
+		Use:   "hardstop {--server-oid SERVER_OID... | --all | --selector SELECTOR}",
 		Short: "Force stop a server.",
-		Long:  "Force stop a server immediately (equivalent to pulling the power cord).",
-		Run:   cmd.runMiddleware.ServerHardstop,
+		Long: `Force stop a server immediately (equivalent to pulling the power cord).
+
+Several servers can be targeted at once with a repeated --server-oid, --all or
+--selector. The list of servers is displayed for confirmation (skip with --yes).`,
+		Example: `  titan-sc server hardstop --server-oid sc-abc123
+  titan-sc server hardstop --selector "name=web-*,state=started" --yes`,
+		Run: cmd.runMiddleware.ServerHardstop,
+	}
+
+	serverSSH := &cobra.Command{
+		Use:   "ssh [NAME|SERVER_OID] [-- COMMAND...]",
+		Short: "Connect to a server with SSH.",
+		Long: `Connect to a server with the local ssh client.
+
+The server is given by name or OID. Its primary IP address and login are used as
+ssh destination. Arguments after "--" are run as a remote command.`,
+		Example: `  titan-sc server ssh web-01
+  titan-sc server ssh web-01 --ipv6 --identity ~/.ssh/titan_ed25519
+  titan-sc server ssh web-01 -o StrictHostKeyChecking=accept-new --ssh-arg=-A
+  titan-sc server ssh web-01 -- sudo systemctl status nginx`,
+		Args: cobra.ArbitraryArgs,
+		Run:  cmd.runMiddleware.ServerSSH,
+	}
+
+	serverExec := &cobra.Command{
+		Use:   "exec {--server-oid SERVER_OID... | --all | --selector SELECTOR} -- COMMAND...",
+		Short: "Run a command on several servers over SSH.",
+		Long: `Run a command on several servers at once with the local ssh client.
+
+Each server is reached on its primary IP address with its login, like 'server ssh'.
+Output lines are prefixed with the server name. With --json, the output and exit code
+of each server are collected instead. The command exits with a non-zero status if it
+failed on any server.`,
+		Example: `  titan-sc server exec --selector tag=web -- uptime
+  titan-sc server exec --all --parallel 20 --timeout 10s -- systemctl is-active nginx
+  titan-sc -j server exec --server-oid sc-abc123,sc-def456 -- df -h /`,
+		Args: cobra.ArbitraryArgs,
+		Run:  cmd.runMiddleware.ServerExec,
+	}
+
+	serverWait := &cobra.Command{
+		Use:   "wait --server-oid SERVER_OID --state STATE [--timeout DURATION]",
+		Short: "Wait for a server to reach a state.",
+		Long: `Wait for a server to reach a state (started or stopped).
+
+The server is polled with an increasing interval until it reaches the requested state.
+Exits with a non-zero status on timeout or if the server enters a failure state
+(deleted, error, failed).`,
+		Example: `  titan-sc server wait --server-oid 604a19c439430d34d52028be --state started --timeout 5m`,
+		Run:     cmd.runMiddleware.ServerWait,
 	}
 
 	serverChangeName := &cobra.Command{
@@ -126,13 +200,29 @@ If --company-oid is not specified, your default company will be used.`,
 	}
 
 	serverCreate := &cobra.Command{
-		Use:    "create --plan PLAN --template-oid OID --confirm-payment",
+		Use:    "create {--plan PLAN --template-oid OID | -f SPEC} --confirm-payment",
 		Short:  "Create a new server.",
-		Long:   "Create a new server.\nGet OS and version list with: titan-sc template list.\n\nPlans and default resources:\n  SC1: 1 CPU, 1 GB RAM, 10 GB disk\n  SC2: 4 CPU, 4 GB RAM, 80 GB disk\n  SC3: 6 CPU, 8 GB RAM, 100 GB disk",
+		Long:   "Create a new server.\nGet OS and version list with: titan-sc template list.\n\nPlans and default resources:\n  SC1: 1 CPU, 1 GB RAM, 10 GB disk\n  SC2: 4 CPU, 4 GB RAM, 80 GB disk\n  SC3: 6 CPU, 8 GB RAM, 100 GB disk\n\nWith -f, the servers described by a YAML or JSON spec file are ordered, then named,\nattached to their private networks and given their reverse once started:\n\n  servers:\n    - name: web-04\n      plan: SC1\n      os: debian            # or template_oid\n      os_version: \"12\"\n      cpu: 2                # optional, plan minimum by default\n      ssh_keys: [laptop]\n      networks: [backend]   # names or OIDs\n      reverse: web-04.example.com",
 		Run:    cmd.runMiddleware.ServerCreate,
 		Hidden: true, // Hidden until properly tested (requires payment)
 	}
 
+	serverClone := &cobra.Command{
+		Use:   "clone --from SERVER --name NAME --confirm-payment",
+		Short: "Order a new server like an existing one.",
+		Long: `Order a new server with the configuration of an existing one: plan, template,
+CPU, RAM, disk and private networks. The order is quoted and confirmed before it
+is bought, then the new server is named and attached to the networks of the source
+once started.
+
+SSH keys cannot be read from a server: give them with --ssh-keys-name (or set a
+--password, --password-stdin, ...). The login is the one of the template.`,
+		Example: `  titan-sc server clone --from web-03 --name web-04 --ssh-keys-name admin --confirm-payment
+  titan-sc server clone --from web-03 --name web-04 --ssh-keys-name admin --dry-run`,
+		Run:    cmd.runMiddleware.ServerClone,
+		Hidden: true, // Hidden like 'create' until properly tested (requires payment)
+	}
+
 	// DRP (Disaster Recovery Plan) commands
 	serverDrp := &cobra.Command{
 		Use:   "drp",
@@ -195,10 +285,14 @@ that you understand the risks involved.`,
 		serverStop,
 		serverRestart,
 		serverHardstop,
+		serverWait,
+		serverSSH,
+		serverExec,
 		serverISO,
 		serverChangeName,
 		serverAddons,
 		serverCreate,
+		serverClone,
 		serverTermination,
 		serverReset,
 		serverDrp)
@@ -214,21 +308,61 @@ that you understand the risks involved.`,
 
 	// Command arguments
 	serverList.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	serverList.Flags().StringSlice("state", nil, "Filter by state (started, stopped, ...).")
+	serverList.Flags().StringSlice("plan", nil, "Filter by plan (SC1, SC2, ...).")
+	serverList.Flags().StringSlice("os", nil, "Filter by OS name or \"name version\" (glob pattern, e.g. 'debian*').")
+	serverList.Flags().StringSlice("site", nil, "Filter by site (main, secondary).")
+	serverList.Flags().StringSlice("tag", nil, "Filter by tag name.")
+	serverList.Flags().StringSlice("drp", nil, "Filter by DRP status (enabled, disabled, error).")
+	serverList.Flags().StringSlice("hypervisor", nil, "Filter by hypervisor OID or hostname (glob pattern).")
+	serverList.Flags().String("name", "", "Filter by name (regular expression).")
+	serverList.Flags().Bool("include-deleted", false, "Also list deleted servers.")
+	_ = serverList.RegisterFlagCompletionFunc("state", cobra.FixedCompletions(append(append([]string{}, api.ServerActiveStates...),
+		run.StateError, run.StateDeleted), cobra.ShellCompDirectiveNoFileComp))
+	_ = serverList.RegisterFlagCompletionFunc("plan", cobra.FixedCompletions(
+		[]string{run.SC1, run.SC2, run.SC3}, cobra.ShellCompDirectiveNoFileComp))
+	_ = serverList.RegisterFlagCompletionFunc("site", cobra.FixedCompletions(
+		[]string{"main", "secondary"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = serverList.RegisterFlagCompletionFunc("drp", cobra.FixedCompletions(
+		[]string{run.DrpSelectorEnabled, run.DrpSelectorDisabled, run.DrpSelectorError}, cobra.ShellCompDirectiveNoFileComp))
 
 	serverDetail.Flags().StringP("server-oid", "s", "", "Set server OID.")
 	_ = serverDetail.MarkFlagRequired("server-oid")
 
-	serverStart.Flags().StringP("server-oid", "s", "", "Set server OID.")
-	_ = serverStart.MarkFlagRequired("server-oid")
-
-	serverStop.Flags().StringP("server-oid", "s", "", "Set server OID.")
-	_ = serverStop.MarkFlagRequired("server-oid")
+	for _, c := range []*cobra.Command{serverStart, serverStop, serverRestart, serverHardstop} {
+		c.Flags().StringSliceP("server-oid", "s", nil, "Set server OID (repeat or comma-separate for several servers).")
+		addBulkFlags(c, run.DefaultBulkParallelism)
+		c.MarkFlagsOneRequired("server-oid", "all", "selector")
+		c.MarkFlagsMutuallyExclusive("server-oid", "all", "selector")
+	}
 
-	serverRestart.Flags().StringP("server-oid", "s", "", "Set server OID.")
-	_ = serverRestart.MarkFlagRequired("server-oid")
+	for _, c := range []*cobra.Command{serverStart, serverStop, serverRestart, serverHardstop, serverReset} {
+		addWaitFlags(c)
+	}
 
-	serverHardstop.Flags().StringP("server-oid", "s", "", "Set server OID.")
-	_ = serverHardstop.MarkFlagRequired("server-oid")
+	serverWait.Flags().StringP("server-oid", "s", "", "Set server OID.")
+	serverWait.Flags().StringP("state", "", "", "State to wait for (started, stopped).")
+	serverWait.Flags().Duration("timeout", run.DefaultWaitTimeout, "Maximum time to wait.")
+	_ = serverWait.MarkFlagRequired("server-oid")
+	_ = serverWait.MarkFlagRequired("state")
+	_ = serverWait.RegisterFlagCompletionFunc("state", cobra.FixedCompletions(
+		[]string{run.StateStarted, run.StateStopped}, cobra.ShellCompDirectiveNoFileComp))
+
+	serverSSH.Flags().StringP("server-oid", "s", "", "Set server OID (instead of the NAME argument).")
+	serverSSH.Flags().StringP("company-oid", "c", "", "Company OID used to find the server by name (uses your default company if not specified).")
+	serverSSH.Flags().String("user", "", "Login to use instead of the server login.")
+	serverSSH.Flags().Bool("ipv6", false, "Connect to the primary IPv6 address.")
+	serverSSH.Flags().Bool("print", false, "Print the ssh command instead of running it.")
+	addSSHFlags(serverSSH)
+
+	serverExec.Flags().StringSliceP("server-oid", "s", nil, "Set server OID (repeat or comma-separate for several servers).")
+	addBulkFlags(serverExec, run.DefaultExecParallelism)
+	serverExec.Flags().Duration("timeout", run.DefaultExecTimeout, "Maximum duration of the command on each server.")
+	serverExec.Flags().String("user", "", "Login to use instead of the server login.")
+	serverExec.Flags().Bool("ipv6", false, "Connect to the primary IPv6 address.")
+	addSSHFlags(serverExec)
+	serverExec.MarkFlagsOneRequired("server-oid", "all", "selector")
+	serverExec.MarkFlagsMutuallyExclusive("server-oid", "all", "selector")
 
 	// ISO mount
 	serverISOMount.Flags().StringP("server-oid", "s", "", "Set server OID.")
@@ -254,10 +388,28 @@ that you understand the risks involved.`,
 	serverAddonsList.Flags().StringP("server-oid", "s", "", "Set server OID.")
 	_ = serverAddonsList.MarkFlagRequired("server-oid")
 
+	// Server clone
+	serverClone.Flags().String("from", "", "Name or OID of the server to clone.")
+	serverClone.Flags().StringP("name", "n", "", "Name of the new server.")
+	serverClone.Flags().StringP("company-oid", "c", "", "Company OID of the servers (uses your default company if not specified).")
+	serverClone.Flags().String("ssh-keys-name", "", "SSH keys: keyname1,keyname2,...,keynameN.")
+	serverClone.Flags().String("password", "", "Password for login (visible in shell history, prefer --password-stdin or --password-file).")
+	addSecretFlags(serverClone, "password", true)
+	serverClone.Flags().Duration("timeout", run.DefaultProvisionTimeout, "Maximum time to wait for the new server to be delivered and started.")
+	serverClone.Flags().Bool("dry-run", false, "Print the itemized price of the clone without buying it.")
+	serverClone.Flags().String("payment-method", "", "Payment method OID (uses default if not specified).")
+	serverClone.Flags().String("subscription-oid", "", "Add the server to existing subscription OID (optional, creates new subscription if not set).")
+	serverClone.Flags().Bool("confirm-payment", false, "Confirm the payment (required to proceed).")
+	serverClone.Flags().Bool("override-budget", false, "Order even if the order exceeds the budget of the profile.")
+	serverClone.Flags().BoolP("yes", "y", false, "Buy without confirmation prompt.")
+	_ = serverClone.MarkFlagRequired("from")
+	_ = serverClone.MarkFlagRequired("name")
+
 	// server reset
 	serverReset.Flags().StringP("server-oid", "s", "", "Set server OID.")
 	serverReset.Flags().StringP("template-oid", "", "", "Set template used for create server.")
-	serverReset.Flags().StringP("password", "", "", "Set user password.")
+	serverReset.Flags().StringP("password", "", "", "Password for login (visible in shell history, prefer --password-stdin or --password-file).")
+	addSecretFlags(serverReset, "password", true)
 	serverReset.Flags().StringP("ssh-keys-name", "", "", "Set ssh keys: keyname1,keyname2,...,keynameN.")
 	_ = serverReset.MarkFlagRequired("server-oid")
 	_ = serverReset.MarkFlagRequired("template-oid")
@@ -268,7 +420,8 @@ that you understand the risks involved.`,
 	// Server create
 	serverCreate.Flags().StringP("plan", "p", "", "Server plan (SC1, SC2, SC3).")
 	serverCreate.Flags().StringP("template-oid", "t", "", "Template OID for the OS.")
-	serverCreate.Flags().StringP("password", "", "", "Password for login.")
+	serverCreate.Flags().StringP("password", "", "", "Password for login (visible in shell history, prefer --password-stdin or --password-file).")
+	addSecretFlags(serverCreate, "password", true)
 	serverCreate.Flags().StringP("ssh-keys-name", "", "", "SSH keys: keyname1,keyname2,...,keynameN.")
 	serverCreate.Flags().IntP("quantity", "", 1, "Number of servers to create.")
 	serverCreate.Flags().IntP("cpu", "c", 0, "Total CPU cores (0 = plan default).")
@@ -277,8 +430,16 @@ that you understand the risks involved.`,
 	serverCreate.Flags().StringP("payment-method", "", "", "Payment method OID (uses default if not specified).")
 	serverCreate.Flags().StringP("subscription-oid", "", "", "Add server to existing subscription OID (optional, creates new subscription if not set).")
 	serverCreate.Flags().BoolP("confirm-payment", "", false, "Confirm the payment (required to proceed).")
-	_ = serverCreate.MarkFlagRequired("plan")
-	_ = serverCreate.MarkFlagRequired("template-oid")
+	serverCreate.Flags().Bool("override-budget", false, "Order even if the order exceeds the budget of the profile.")
+	serverCreate.Flags().Bool("dry-run", false, "Build the cart and print its itemized price without buying.")
+	serverCreate.Flags().Bool("quote", false, "Same as --dry-run.")
+	serverCreate.Flags().StringP("file", "f", "", "Spec file describing the servers to create, YAML or JSON (\"-\" for stdin).")
+	serverCreate.Flags().Duration("timeout", run.DefaultProvisionTimeout, "Maximum time to wait for the servers to start (with --file).")
+	serverCreate.MarkFlagsRequiredTogether("plan", "template-oid")
+	serverCreate.MarkFlagsOneRequired("plan", "file")
+	for _, flag := range []string{"plan", "template-oid", "ssh-keys-name", "quantity", "cpu", "ram", "disk"} {
+		serverCreate.MarkFlagsMutuallyExclusive("file", flag)
+	}
 
 	// DRP status
 	serverDrpStatus.Flags().StringP("server-oid", "s", "", "Server OID.")
@@ -300,3 +461,27 @@ that you understand the risks involved.`,
 	serverDrpResync.Flags().BoolP("yes-i-understand-i-will-lose-data", "", false, "Confirm that you understand this operation will cause data loss.")
 	_ = serverDrpResync.MarkFlagRequired("server-oid")
 }
+
+// addWaitFlags adds --wait and --timeout to a state-changing server command
+func addWaitFlags(c *cobra.Command) {
+	c.Flags().Bool("wait", false, "Wait until the server reaches the resulting state.")
+	c.Flags().Duration("timeout", run.DefaultWaitTimeout, "Maximum time to wait (with --wait).")
+}
+
+// addBulkFlags adds the flags used to run a command on several servers at once,
+// parallel of them by default
+func addBulkFlags(c *cobra.Command, parallel int) {
+	c.Flags().Bool("all", false, "Target all servers of the company.")
+	c.Flags().String("selector", "", "Target servers matching a selector "+
+		"(e.g. \"name=web-*,state=started|stopped,plan=SC2,os=debian*,site=main,tag=web,drp=enabled\").")
+	c.Flags().StringP("company-oid", "c", "", "Company OID for --all and --selector (uses your default company if not specified).")
+	c.Flags().Int("parallel", parallel, "Number of servers processed at once.")
+	c.Flags().BoolP("yes", "y", false, "Do not ask for confirmation when several servers are targeted.")
+}
+
+// addSSHFlags adds the local ssh client options shared by SSH-based commands
+func addSSHFlags(c *cobra.Command) {
+	c.Flags().StringP("identity", "i", "", "Private key file passed to ssh (-i).")
+	c.Flags().StringArrayP("option", "o", nil, "ssh option in KEY=VALUE format, passed as -o (repeatable).")
+	c.Flags().StringArray("ssh-arg", nil, "Extra raw ssh argument, e.g. --ssh-arg=-A (repeatable).")
+}
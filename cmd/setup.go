@@ -3,9 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"titan-sc/api"
+	"titan-sc/run"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,7 +19,8 @@ func (cmd *CMD) SetupCmdAdd() {
 		Short: "Configure CLI with your API credentials.",
 		Long: `Configure the CLI with your API token and optional custom API endpoint.
 
-The token will be validated before saving.
+The token will be validated before saving. Without --token, --token-stdin or
+--token-file, it is asked for without echo.
 
 Configuration is stored in:
   - Linux/macOS: ~/.titan/config
@@ -26,6 +29,8 @@ Configuration is stored in:
 The CLI also checks the current directory for a config or config.toml file as a fallback.
 
 Examples:
+  titan-sc setup
+  titan-sc setup --token-file ~/titan-token
   titan-sc setup --token "your-api-token"
   titan-sc setup --token "your-api-token" --uri "https://custom-api.example.com/v2"`,
 		Run:     cmd.setupApp,
@@ -34,17 +39,28 @@ Examples:
 
 	cmd.RootCommand.AddCommand(setupCmd)
 
-	setupCmd.Flags().StringP("token", "t", "", "API authentication token.")
+	setupCmd.Flags().StringP("token", "t", "", "API authentication token (visible in shell history, prefer --token-stdin or --token-file).")
 	setupCmd.Flags().String("uri", api.DefaultURI, "Custom API endpoint URL.")
-	_ = setupCmd.MarkFlagRequired("token")
+	addSecretFlags(setupCmd, "token", false)
 }
 
 func (cmd *CMD) setupApp(cobraCommand *cobra.Command, args []string) {
 	_ = args
 	cmd.runMiddleware.ParseGlobalFlags(cobraCommand)
 
-	token, _ := cobraCommand.Flags().GetString("token")
 	uri, _ := cobraCommand.Flags().GetString("uri")
+	token, err := cmd.runMiddleware.ReadSecretFlag(cobraCommand, "token")
+	if err == nil && token == "" {
+		if !cmd.runMiddleware.IsInteractive() {
+			err = fmt.Errorf("token is required: use --token, --token-stdin or --token-file")
+		} else {
+			token, err = cmd.runMiddleware.PromptSecret("API token", false)
+		}
+	}
+	if err != nil {
+		fmt.Printf("%s %s\n", cmd.runMiddleware.Colorize("Error:", "red"), err.Error())
+		os.Exit(1)
+	}
 
 	// Validate token
 	fmt.Print("Validating token... ")
@@ -82,32 +98,14 @@ func validateToken(token, uri string) error {
 	return nil
 }
 
-// getConfigDir returns the directory where config should be stored
-func getConfigDir() string {
-	if runtime.GOOS == "windows" {
-		if appData := os.Getenv("APPDATA"); appData != "" {
-			return appData + "\\titan"
-		}
-		return "."
-	}
-	if home := os.Getenv("HOME"); home != "" {
-		return home + "/.titan"
-	}
-	return "."
-}
-
 // getConfigPath returns the full path to the config file
 func getConfigPath() string {
-	dir := getConfigDir()
-	if runtime.GOOS == "windows" {
-		return dir + "\\config"
-	}
-	return dir + "/config"
+	return filepath.Join(run.ConfigDir(), "config")
 }
 
 // saveConfig writes the token and URI to the config file
 func saveConfig(token, uri string) error {
-	configDir := getConfigDir()
+	configDir := run.ConfigDir()
 	configPath := getConfigPath()
 
 	// Create directory if it doesn't exist
@@ -123,6 +121,10 @@ func saveConfig(token, uri string) error {
 	if uri != "" && uri != api.DefaultURI {
 		data["uri"] = uri
 	}
+	// Keep the purchase budget
+	if budget := viper.Get("default.budget"); budget != nil {
+		data["budget"] = budget
+	}
 
 	viper.Set("default", data)
 	viper.SetConfigType("toml")
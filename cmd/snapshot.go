@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"titan-sc/run"
+
 	"github.com/spf13/cobra"
 )
 
@@ -29,7 +31,7 @@ Examples:
 	}
 
 	snapshotCreate := &cobra.Command{
-		Use:   "create --server-oid SERVER_OID",
+		Use:   "create {--server-oid SERVER_OID... | --all | --selector SELECTOR}",
 		Short: "Create a snapshot of a server.",
 		Long: `Create a new snapshot of a server.
 
@@ -40,6 +42,9 @@ Examples:
   # Force create when quota is reached
   titan-sc snapshot create --server-oid sc-abc123 --yes-i-agree-to-erase-oldest-snapshot
 
+  # Snapshot every server tagged "db", erasing the oldest snapshot when needed
+  titan-sc snapshot create --selector tag=db --yes-i-agree-to-erase-oldest-snapshot --yes
+
   # Using API v1 (legacy, deprecated - will be removed in future versions)
   titan-sc snapshot create --server-uuid 12345678-1234-1234-1234-123456789abc`,
 		Run: cmd.runMiddleware.SnapshotCreate,
@@ -105,11 +110,12 @@ Examples:
 	snapshotDelete.MarkFlagsMutuallyExclusive("snapshot-oid", "snapshot-uuid")
 
 	// Create: OID or legacy UUID
-	snapshotCreate.Flags().StringP("server-oid", "s", "", "Set server OID (API v2).")
+	snapshotCreate.Flags().StringSliceP("server-oid", "s", nil, "Set server OID (API v2, repeat for several servers).")
 	snapshotCreate.Flags().StringP("server-uuid", "u", "", "Legacy: Set server UUID (API v1).")
 	snapshotCreate.Flags().BoolP("yes-i-agree-to-erase-oldest-snapshot", "", false,
 		"Automatically erase oldest snapshot if quota has been reached.")
-	snapshotCreate.MarkFlagsMutuallyExclusive("server-oid", "server-uuid")
+	addBulkFlags(snapshotCreate, run.DefaultBulkParallelism)
+	snapshotCreate.MarkFlagsMutuallyExclusive("server-oid", "server-uuid", "all", "selector")
 
 	// List: OID or legacy UUID
 	snapshotList.Flags().StringP("server-oid", "s", "", "Set server OID (API v2).")
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"titan-sc/run"
+
+	"github.com/spf13/cobra"
+)
+
+func (cmd *CMD) SSHConfigCmdAdd() {
+	sshConfig := &cobra.Command{
+		Use:     "ssh-config",
+		Short:   "Manage OpenSSH client configuration for your servers.",
+		Long:    "Manage OpenSSH client configuration for your servers.",
+		GroupID: "fleet",
+	}
+
+	sshConfigGenerate := &cobra.Command{
+		Use:   "generate [--company-oid COMPANY_OID] [--selector SELECTOR] [--file FILE]",
+		Short: "Generate Host entries for your servers.",
+		Long: `Generate an OpenSSH Host entry for each server, using its name, primary IP address
+and login.
+
+Entries are written into a block delimited by markers in an include file
+(default ` + run.DefaultSSHConfigFile + `). Each company has its own block, which is
+replaced on every run: running the command again only updates the file when servers
+changed, and everything outside of the block is left untouched.
+
+Include the file at the top of ~/.ssh/config:
+  Include config.d/titan`,
+		Example: `  titan-sc ssh-config generate
+  titan-sc ssh-config generate --selector "tag=web" --identity ~/.ssh/titan_ed25519
+  titan-sc ssh-config generate --stdout`,
+		Run: cmd.runMiddleware.SSHConfigGenerate,
+	}
+
+	sshConfig.AddCommand(sshConfigGenerate)
+	cmd.RootCommand.AddCommand(sshConfig)
+
+	sshConfigGenerate.Flags().StringP("company-oid", "c", "", "Company OID (uses your default company if not specified).")
+	sshConfigGenerate.Flags().String("selector", "", "Only include servers matching a selector (e.g. \"tag=web,state=started\").")
+	sshConfigGenerate.Flags().StringP("file", "f", run.DefaultSSHConfigFile, "Include file to update.")
+	sshConfigGenerate.Flags().Bool("stdout", false, "Print the entries instead of writing the file.")
+	sshConfigGenerate.Flags().Bool("ipv6", false, "Use the primary IPv6 address of each server.")
+	sshConfigGenerate.Flags().StringP("identity", "i", "", "IdentityFile to set on every entry.")
+}
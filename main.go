@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strings"
@@ -16,6 +17,7 @@ const (
 	EnvApiToken    = "TITAN_API_TOKEN"
 	EnvApiUri      = "TITAN_URI"
 	ConfigFileName = "config"
+	ConfigProfile  = "default"
 	VersionMajor   = 4
 	VersionMinor   = 0
 	VersionPatch   = 0
@@ -53,12 +55,21 @@ func init() {
 
 	apiInstance = api.NewAPI(token, uri, operatingsystem, fmt.Sprintf("%d.%d.%d", VersionMajor, VersionMinor, VersionPatch))
 	runInstance = run.NewRunMiddleware(apiInstance)
+	runInstance.Profile = ConfigProfile
+	runInstance.Budget = getBudgetFromFile()
+	runInstance.PurchaseLogPath = run.DefaultPurchaseLogPath()
+	runInstance.CartPath = run.DefaultCartPath()
 	cmdInstance = cmd.NewCMD(getProgramName(), ConfigFileName, tokenDefined, runInstance, VersionMajor, VersionMinor,
 		VersionPatch)
 
 	cmdInstance.CompletionCmdAdd()
 	cmdInstance.CompanyCmdAdd()
 	cmdInstance.ServerCmdAdd()
+	cmdInstance.CartCmdAdd()
+	cmdInstance.SSHConfigCmdAdd()
+	cmdInstance.InventoryCmdAdd()
+	cmdInstance.DNSCmdAdd()
+	cmdInstance.ManifestCmdAdd()
 	cmdInstance.TemplateCmdAdd()
 	cmdInstance.SnapshotCmdAdd()
 	cmdInstance.HistoryCmdAdd()
@@ -67,6 +78,7 @@ func init() {
 	cmdInstance.IpCmdAdd()
 	cmdInstance.UserCmdAdd()
 	cmdInstance.SetupCmdAdd()
+	cmdInstance.BudgetCmdAdd()
 	cmdInstance.SSHKeysCmdAdd()
 	cmdInstance.SubscriptionCmdAdd()
 	cmdInstance.VersionCmdAdd()
@@ -100,6 +112,14 @@ func getApiUriFromFile() string {
 	return viper.GetString("default.uri")
 }
 
+// getBudgetFromFile reads the purchase budget of the profile, TTC in currency units
+func getBudgetFromFile() run.Budget {
+	return run.Budget{
+		MaxOrderTTC:        int64(math.Round(viper.GetFloat64(ConfigProfile+".budget.max_order_ttc") * 100)),
+		MaxServersPerOrder: viper.GetInt(ConfigProfile + ".budget.max_servers_per_order"),
+	}
+}
+
 func getApiUriFromEnv() string {
 	return os.Getenv(EnvApiUri)
 }
@@ -119,20 +139,10 @@ func loadConfigurationFile() {
 	viper.SetConfigType("toml")
 	viper.SetConfigName(ConfigFileName)
 
-	// Add config paths in order of priority (first found wins)
-	if runtime.GOOS == "windows" {
-		// Windows: check APPDATA first, then current directory
-		if appData := os.Getenv("APPDATA"); appData != "" {
-			viper.AddConfigPath(appData + "\\titan")
-		}
-		viper.AddConfigPath(".")
-	} else {
-		// Unix/macOS: check ~/.titan first, then current directory
-		if home := os.Getenv("HOME"); home != "" {
-			viper.AddConfigPath(home + "/.titan")
-		}
-		viper.AddConfigPath(".")
-	}
+	// Add config paths in order of priority (first found wins): the config directory
+	// (%APPDATA%\titan on Windows, ~/.titan otherwise), then the current directory
+	viper.AddConfigPath(run.ConfigDir())
+	viper.AddConfigPath(".")
 
 	_ = viper.ReadInConfig()
 }
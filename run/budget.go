@@ -0,0 +1,271 @@
+package run
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// Budget limits the orders of a configuration profile, read from its 'budget'
+// section. Zero means no limit.
+type Budget struct {
+	MaxOrderTTC        int64 `json:"max_order_ttc"` // Cents
+	MaxServersPerOrder int   `json:"max_servers_per_order"`
+}
+
+// ErrBudgetExceeded is returned when an order exceeds the budget of the profile
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Purchase statuses recorded in the purchase log
+const (
+	PurchaseBlocked   = "blocked"
+	PurchaseFailed    = "failed"
+	PurchaseCompleted = "purchased"
+)
+
+// PurchaseRecord is a purchase attempt, appended as a JSON line to the purchase log
+type PurchaseRecord struct {
+	Time             time.Time `json:"time"`
+	Profile          string    `json:"profile"`
+	Command          string    `json:"command"`
+	CartOID          string    `json:"cart_oid"`
+	PaymentMethodOID string    `json:"payment_method_oid,omitempty"`
+	SubscriptionOID  string    `json:"subscription_oid,omitempty"`
+	Servers          int       `json:"servers"`
+	HT               int64     `json:"ht"`  // Cents
+	TTC              int64     `json:"ttc"` // Cents
+	Currency         string    `json:"currency"`
+	Status           string    `json:"status"`
+	BudgetOverridden bool      `json:"budget_overridden,omitempty"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// cartPurchase is a cart to buy within the budget. Already ordered servers and
+// spent amounts count against the budget when one command places several orders.
+type cartPurchase struct {
+	command          string
+	cartOID          string
+	paymentMethodOID string
+	subscriptionOID  string
+	servers          int
+	overrideBudget   bool
+
+	previousServers int
+	previousTTC     int64
+}
+
+// DefaultPurchaseLogPath returns the path of the purchase log, next to the configuration file
+func DefaultPurchaseLogPath() string {
+	return filepath.Join(ConfigDir(), "purchases.log")
+}
+
+// check returns ErrBudgetExceeded if an order of servers for ttc cents goes over the budget
+func (b Budget) check(servers int, ttc int64) error {
+	if b.MaxServersPerOrder > 0 && servers > b.MaxServersPerOrder {
+		return fmt.Errorf("%w: %d server(s) ordered, the limit is %d per order", ErrBudgetExceeded, servers, b.MaxServersPerOrder)
+	}
+	if b.MaxOrderTTC > 0 && ttc > b.MaxOrderTTC {
+		return fmt.Errorf("%w: order of %s TTC, the limit is %s", ErrBudgetExceeded,
+			formatMoney(ttc, DefaultCurrency), formatMoney(b.MaxOrderTTC, DefaultCurrency))
+	}
+	return nil
+}
+
+// checkBudget checks a whole order made of several carts against the budget before
+// any of them is bought. A blocked order is recorded in the purchase log.
+func (run *RunMiddleware) checkBudget(command string, servers int, ht, ttc int64, overrideBudget bool) error {
+	err := run.Budget.check(servers, ttc)
+	if err == nil || overrideBudget {
+		return nil
+	}
+	run.recordPurchase(&PurchaseRecord{
+		Time:     time.Now().UTC(),
+		Profile:  run.Profile,
+		Command:  command,
+		Servers:  servers,
+		HT:       ht,
+		TTC:      ttc,
+		Currency: DefaultCurrency,
+		Status:   PurchaseBlocked,
+		Error:    err.Error(),
+	})
+	return fmt.Errorf("%w; add --override-budget to proceed anyway", err)
+}
+
+// buyCart prices a cart, checks it against the budget of the profile and buys it.
+// Every attempt, blocked or not, is recorded in the purchase log.
+func (run *RunMiddleware) buyCart(purchase *cartPurchase) (*api.CartAmount, error) {
+	price, err := run.API.GetCartPrice(purchase.cartOID)
+	if err != nil {
+		return nil, err
+	}
+	record := PurchaseRecord{
+		Time:             time.Now().UTC(),
+		Profile:          run.Profile,
+		Command:          purchase.command,
+		CartOID:          purchase.cartOID,
+		PaymentMethodOID: purchase.paymentMethodOID,
+		SubscriptionOID:  purchase.subscriptionOID,
+		Servers:          purchase.servers,
+		HT:               price.Amount.HT,
+		TTC:              price.Amount.TTC,
+		Currency:         DefaultCurrency,
+	}
+
+	if err = run.Budget.check(purchase.previousServers+purchase.servers, purchase.previousTTC+price.Amount.TTC); err != nil {
+		if !purchase.overrideBudget {
+			record.Status, record.Error = PurchaseBlocked, err.Error()
+			run.recordPurchase(&record)
+			return &price.Amount, fmt.Errorf("%w; add --override-budget to proceed anyway", err)
+		}
+		record.BudgetOverridden = true
+	}
+
+	if !run.JSONOutput {
+		fmt.Printf("Price: %s TTC (%s HT)\n", formatMoney(price.Amount.TTC, DefaultCurrency), formatMoney(price.Amount.HT, DefaultCurrency))
+		fmt.Println("Processing payment...")
+	}
+	if err = run.API.BuyCart(purchase.cartOID, purchase.paymentMethodOID, purchase.subscriptionOID); err != nil {
+		record.Status, record.Error = PurchaseFailed, err.Error()
+		run.recordPurchase(&record)
+		return &price.Amount, err
+	}
+	record.Status = PurchaseCompleted
+	run.recordPurchase(&record)
+	return &price.Amount, nil
+}
+
+// recordPurchase appends a record to the purchase log. A failure to write it is
+// reported but does not undo the purchase.
+func (run *RunMiddleware) recordPurchase(record *PurchaseRecord) {
+	if run.PurchaseLogPath == "" {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = appendPurchaseLog(run.PurchaseLogPath, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed to write purchase log %s: %s\n", run.Colorize("Warning:", "yellow"), run.PurchaseLogPath, err)
+	}
+}
+
+func appendPurchaseLog(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// BudgetShow prints the budget of the profile and the purchase log path
+func (run *RunMiddleware) BudgetShow(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	if run.JSONOutput {
+		printAsJson(map[string]interface{}{
+			"profile":           run.Profile,
+			"budget":            run.Budget,
+			"purchase_log_path": run.PurchaseLogPath,
+		})
+		return
+	}
+
+	maxTTC, maxServers := "no limit", "no limit"
+	if run.Budget.MaxOrderTTC > 0 {
+		maxTTC = formatMoney(run.Budget.MaxOrderTTC, DefaultCurrency)
+	}
+	if run.Budget.MaxServersPerOrder > 0 {
+		maxServers = fmt.Sprintf("%d", run.Budget.MaxServersPerOrder)
+	}
+	fmt.Printf("Profile:               %s\n", run.Colorize(run.Profile, "cyan"))
+	fmt.Printf("Max TTC per order:     %s\n", maxTTC)
+	fmt.Printf("Max servers per order: %s\n", maxServers)
+	fmt.Printf("Purchase log:          %s\n", run.PurchaseLogPath)
+}
+
+// BudgetLog lists the most recent purchase attempts of the purchase log
+func (run *RunMiddleware) BudgetLog(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	records, err := readPurchaseLog(run.PurchaseLogPath)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	if run.JSONOutput {
+		printAsJson(records)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("No purchase recorded.")
+		return
+	}
+	table := NewTable("TIME", "PROFILE", "COMMAND", "SERVERS", "TTC", "STATUS", "DETAIL")
+	table.SetNoColor(!run.Color)
+	for _, record := range records {
+		var statusColorFn func(string) string
+		if run.Color {
+			statusColorFn = ColorFn(map[string]string{PurchaseCompleted: "green", PurchaseBlocked: "yellow", PurchaseFailed: "red"}[record.Status])
+		}
+		detail := record.Error
+		if record.BudgetOverridden {
+			detail = "budget overridden"
+		}
+		table.AddRow(
+			ColTimestamp(record.Time.Local().Format("2006-01-02 15:04:05")),
+			Col(record.Profile),
+			Col(record.Command),
+			ColCount(fmt.Sprintf("%d", record.Servers)),
+			Col(formatMoney(record.TTC, record.Currency)),
+			ColColor(record.Status, statusColorFn),
+			Col(detail),
+		)
+	}
+	table.Print()
+}
+
+// readPurchaseLog reads the records of the purchase log, oldest first
+func readPurchaseLog(path string) ([]PurchaseRecord, error) {
+	records := []PurchaseRecord{}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record PurchaseRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,212 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultBulkParallelism is the number of servers processed at once by bulk operations
+const DefaultBulkParallelism = 4
+
+var ErrBulkNotConfirmed = errors.New("operation not confirmed: use --yes to run it without prompt")
+
+// BulkResult is the outcome of an operation on a single server
+type BulkResult struct {
+	ServerOID string `json:"server_oid"`
+	Name      string `json:"name"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// isBulkRequest returns true when the command targets several servers:
+// --all, --selector or more than one --server-oid.
+func isBulkRequest(cmd *cobra.Command) bool {
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		return true
+	}
+	if selector, _ := cmd.Flags().GetString("selector"); selector != "" {
+		return true
+	}
+	serverOIDs, err := cmd.Flags().GetStringSlice("server-oid")
+	return err == nil && len(serverOIDs) > 1
+}
+
+// ResolveServerTargets returns the servers targeted by --server-oid, --all or --selector
+// within the company given by --company-oid (default company otherwise).
+func (run *RunMiddleware) ResolveServerTargets(cmd *cobra.Command) ([]api.ServerDetail, error) {
+	all, _ := cmd.Flags().GetBool("all")
+	selectorExpr, _ := cmd.Flags().GetString("selector")
+	serverOIDs, _ := cmd.Flags().GetStringSlice("server-oid")
+
+	var selector *ServerSelector
+	if selectorExpr != "" {
+		var err error
+		if selector, err = ParseServerSelector(selectorExpr); err != nil {
+			return nil, err
+		}
+	}
+
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		return nil, err
+	}
+	servers, apiReturn, err := run.API.ServerList(companyOID)
+	if err != nil {
+		return nil, err
+	}
+	if apiReturn != nil && apiReturn.Error() {
+		return nil, apiReturn.AsError()
+	}
+
+	switch {
+	case all:
+		return servers, nil
+	case selector != nil:
+		return selector.Filter(servers), nil
+	}
+
+	byOID := make(map[string]api.ServerDetail, len(servers))
+	for _, server := range servers {
+		byOID[server.OID] = server
+	}
+	targets := make([]api.ServerDetail, 0, len(serverOIDs))
+	var missing []string
+	for _, oid := range serverOIDs {
+		server, ok := byOID[oid]
+		if !ok {
+			missing = append(missing, oid)
+			continue
+		}
+		targets = append(targets, server)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("server(s) not found in company %s: %s", companyOID, strings.Join(missing, ", "))
+	}
+	return targets, nil
+}
+
+// runBulkOperation resolves the targeted servers, asks for confirmation (unless --yes),
+// runs op on each of them with at most --parallel concurrent calls and prints a summary.
+// Exits with a non-zero status if any server failed.
+func (run *RunMiddleware) runBulkOperation(cmd *cobra.Command, action string, op func(server *api.ServerDetail) error) {
+	servers, err := run.ResolveServerTargets(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if len(servers) == 0 {
+		run.OutputErrorAndExit(errors.New("no server matches the given criteria"))
+	}
+
+	if err = run.confirmBulkOperation(cmd, action, servers); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	results := runBulk(servers, parallel, op)
+	run.printBulkResults(results)
+
+	for _, result := range results {
+		if !result.Success {
+			os.Exit(1)
+		}
+	}
+}
+
+// confirmBulkOperation lists the targeted servers and prompts the user.
+// Without a terminal (or in JSON mode), --yes is mandatory.
+func (run *RunMiddleware) confirmBulkOperation(cmd *cobra.Command, action string, servers []api.ServerDetail) error {
+	if yes, _ := cmd.Flags().GetBool("yes"); !yes && run.IsInteractive() {
+		fmt.Printf("The following %d server(s) will be affected by '%s':\n", len(servers), action)
+		for _, server := range servers {
+			fmt.Printf("  - %s (%s) %s\n", run.Colorize(server.Name, "cyan"), server.OID,
+				GetStateColorized(run.Color, serverState(&server)))
+		}
+	}
+	return run.confirmAction(cmd, "Are you sure you want to continue?")
+}
+
+// confirmAction asks question (y/N) unless --yes is set.
+// Without a terminal (or in JSON mode), --yes is mandatory.
+func (run *RunMiddleware) confirmAction(cmd *cobra.Command, question string) error {
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return nil
+	}
+	if !run.IsInteractive() {
+		return ErrBulkNotConfirmed
+	}
+	lowerText := keyboardPromptToLower(question + " (y/N): ")
+	if lowerText != "y" && lowerText != "yes" {
+		return errors.New("operation cancelled, nothing has been changed")
+	}
+	return nil
+}
+
+// runBulk calls op on every server with at most parallel concurrent calls.
+// Results are returned in the order of servers.
+func runBulk(servers []api.ServerDetail, parallel int, op func(server *api.ServerDetail) error) []BulkResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]BulkResult, len(servers))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			server := &servers[i]
+			results[i] = BulkResult{ServerOID: server.OID, Name: server.Name, Success: true}
+			if err := op(server); err != nil {
+				results[i].Success = false
+				results[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func (run *RunMiddleware) printBulkResults(results []BulkResult) {
+	if run.JSONOutput {
+		printAsJson(results)
+		return
+	}
+
+	failed := 0
+	table := NewTable("NAME", "OID", "RESULT", "ERROR")
+	table.SetNoColor(!run.Color)
+	for _, result := range results {
+		status, color := "ok", "green"
+		if !result.Success {
+			status, color = "failed", "red"
+			failed++
+		}
+		var colorFn func(string) string
+		if run.Color {
+			colorFn = func(s string) string { return run.Colorize(s, color) }
+		}
+		table.AddRow(
+			ColName(result.Name),
+			ColOID(result.ServerOID),
+			ColColor(status, colorFn),
+			Col(result.Error),
+		)
+	}
+	table.Print()
+
+	if failed > 0 {
+		fmt.Printf("%s %d/%d server(s) failed\n", run.Colorize("Error:", "red"), failed, len(results))
+	} else {
+		fmt.Printf("%s %d server(s) processed\n", run.Colorize("Success:", "green"), len(results))
+	}
+}
@@ -0,0 +1,413 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// CartEntryServer is the type of the cart entries ordering servers, the only type
+// the API can order for now: it documents no endpoint to buy addons for an existing server
+const CartEntryServer = "server"
+
+// Cart is an order assembled with the 'cart' commands. It is kept in a local file
+// until it is bought: an API cart holding all its entries is only created to price
+// and buy it.
+type Cart struct {
+	Entries []CartEntry `json:"entries"`
+}
+
+// CartEntry is servers to order
+type CartEntry struct {
+	Type        string `json:"type"`
+	Quantity    int    `json:"quantity"`
+	Plan        string `json:"plan,omitempty"`
+	TemplateOID string `json:"template_oid,omitempty"`
+	Template    string `json:"template,omitempty"`
+	CPU         int    `json:"cpu,omitempty"`
+	RAM         int    `json:"ram,omitempty"`
+	Disk        int    `json:"disk,omitempty"`
+	SSHKeys     string `json:"ssh_keys,omitempty"`
+}
+
+// CartEntryPrice is the price of a cart entry alone
+type CartEntryPrice struct {
+	Index       int            `json:"index"`
+	Entry       CartEntry      `json:"entry"`
+	Amount      api.CartAmount `json:"amount"`
+	Description string         `json:"description"`
+}
+
+// CartPriceResult is returned as JSON by 'cart price' and 'cart buy'. Amounts are in cents.
+// All the entries are in one API cart, bought with a single payment.
+type CartPriceResult struct {
+	CartOID  string           `json:"cart_oid"`
+	Entries  []CartEntryPrice `json:"entries"`
+	Servers  int              `json:"servers"`
+	HT       int64            `json:"ht"`
+	TVA      int64            `json:"tva"`
+	TTC      int64            `json:"ttc"`
+	Discount int64            `json:"discount"`
+	Currency string           `json:"currency"`
+	Bought   bool             `json:"bought,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// DefaultCartPath returns the path of the local cart, next to the configuration file
+func DefaultCartPath() string {
+	return filepath.Join(ConfigDir(), "cart.json")
+}
+
+func loadCart(path string) (*Cart, error) {
+	cart := &Cart{Entries: []CartEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cart, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, cart); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cart, nil
+}
+
+func saveCart(path string, cart *Cart) error {
+	data, err := json.MarshalIndent(cart, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// describe returns a one-line description of a cart entry
+func (e *CartEntry) describe() string {
+	info := CreateServerInfo{plan: e.Plan, cpu: e.CPU, ram: e.RAM, disk: e.Disk}
+	return fmt.Sprintf("%s server, %s, %s", e.Plan, e.Template, describeResources(&info))
+}
+
+// servers returns the number of servers a cart entry orders
+func (e *CartEntry) servers() int {
+	if e.Type == CartEntryServer {
+		return e.Quantity
+	}
+	return 0
+}
+
+// CartShow lists the entries of the local cart
+func (run *RunMiddleware) CartShow(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	cart, err := loadCart(run.CartPath)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(cart)
+		return
+	}
+	if len(cart.Entries) == 0 {
+		fmt.Println("Cart is empty.")
+		return
+	}
+
+	table := NewTable("#", "TYPE", "DESCRIPTION", "QUANTITY")
+	table.SetNoColor(!run.Color)
+	for i, entry := range cart.Entries {
+		table.AddRow(
+			Col(strconv.Itoa(i+1)),
+			Col(entry.Type),
+			ColName(entry.describe()),
+			ColCount(strconv.Itoa(entry.Quantity)),
+		)
+	}
+	table.Print()
+}
+
+// CartAddServer adds servers to the local cart
+func (run *RunMiddleware) CartAddServer(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	info := CreateServerInfo{}
+	info.parse(cmd)
+	if err := errors.Join(info.validate()...); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if info.quantity < 1 {
+		run.OutputErrorAndExit(errors.New("--quantity must be at least 1"))
+	}
+	template, err := run.API.GetTemplateByOID(info.templateOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if template.Type != OSTypeWindows {
+		if info.sshKeysName == "" {
+			run.OutputErrorAndExit(errors.New("--ssh-keys-name is required: passwords are not stored in the cart"))
+		}
+		if _, err = run.getSSHKeysValue(info.sshKeysName); err != nil {
+			run.OutputErrorAndExit(err)
+		}
+	}
+
+	run.addCartEntry(CartEntry{
+		Type:        CartEntryServer,
+		Quantity:    info.quantity,
+		Plan:        info.plan,
+		TemplateOID: template.OID,
+		Template:    strings.TrimSpace(template.OS + " " + template.Version),
+		CPU:         info.cpu,
+		RAM:         info.ram,
+		Disk:        info.disk,
+		SSHKeys:     info.sshKeysName,
+	})
+}
+
+func (run *RunMiddleware) addCartEntry(entry CartEntry) {
+	cart, err := loadCart(run.CartPath)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	cart.Entries = append(cart.Entries, entry)
+	if err = saveCart(run.CartPath, cart); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(cart)
+		return
+	}
+	fmt.Printf("%s added %d x %s (%d item(s) in cart)\n", run.Colorize("Success:", "green"), entry.Quantity, entry.describe(), len(cart.Entries))
+}
+
+// CartRemove removes entries from the local cart by index, as listed by 'cart show'
+func (run *RunMiddleware) CartRemove(cmd *cobra.Command, args []string) {
+	run.ParseGlobalFlags(cmd)
+	cart, err := loadCart(run.CartPath)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	remove := map[int]bool{}
+	for _, arg := range args {
+		index, err := strconv.Atoi(arg)
+		if err != nil || index < 1 || index > len(cart.Entries) {
+			run.OutputErrorAndExit(fmt.Errorf("invalid index '%s': the cart has %d item(s)", arg, len(cart.Entries)))
+		}
+		remove[index-1] = true
+	}
+
+	entries := make([]CartEntry, 0, len(cart.Entries))
+	for i, entry := range cart.Entries {
+		if !remove[i] {
+			entries = append(entries, entry)
+		}
+	}
+	cart.Entries = entries
+	if err = saveCart(run.CartPath, cart); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(cart)
+		return
+	}
+	fmt.Printf("%s removed %d item(s) (%d item(s) in cart)\n", run.Colorize("Success:", "green"), len(remove), len(cart.Entries))
+}
+
+// CartClear empties the local cart
+func (run *RunMiddleware) CartClear(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	if err := saveCart(run.CartPath, &Cart{Entries: []CartEntry{}}); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(map[string]string{"success": "Cart cleared"})
+		return
+	}
+	fmt.Printf("%s cart cleared\n", run.Colorize("Success:", "green"))
+}
+
+// CartPrice prices every entry of the local cart and the total, in one API cart
+func (run *RunMiddleware) CartPrice(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	cart, err := loadCart(run.CartPath)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if len(cart.Entries) == 0 {
+		run.OutputErrorAndExit(errors.New("cart is empty"))
+	}
+	result, err := run.buildCart(cart)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(result)
+		return
+	}
+	run.printCartPrice(result)
+}
+
+// CartBuy prices the local cart as a single API cart, checks it against the budget
+// as one order and buys it with one payment. The local cart is emptied once bought,
+// and left unchanged if the purchase fails.
+func (run *RunMiddleware) CartBuy(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	confirmPayment, _ := cmd.Flags().GetBool("confirm-payment")
+	overrideBudget, _ := cmd.Flags().GetBool("override-budget")
+	paymentMethodOID, _ := cmd.Flags().GetString("payment-method")
+	subscriptionOID, _ := cmd.Flags().GetString("subscription-oid")
+
+	cart, err := loadCart(run.CartPath)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if len(cart.Entries) == 0 {
+		run.OutputErrorAndExit(errors.New("cart is empty"))
+	}
+	if !confirmPayment {
+		run.OutputErrorAndExit(errors.New("payment not confirmed: add --confirm-payment flag to proceed"))
+	}
+	user, err := run.API.GetUserInfos()
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if paymentMethodOID == "" {
+		if paymentMethodOID, err = run.defaultPaymentMethod(user.DefaultCompanyOID); err != nil {
+			run.OutputErrorAndExit(err)
+		}
+	}
+
+	result, err := run.buildCart(cart)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if !run.JSONOutput {
+		run.printCartPrice(result)
+	}
+	if err = run.checkBudget(cmd.CommandPath(), result.Servers, result.HT, result.TTC, overrideBudget); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	question := fmt.Sprintf("Buy %d item(s) for %s TTC?", len(result.Entries), formatMoney(result.TTC, result.Currency))
+	if err = run.confirmAction(cmd, question); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	price, err := run.buyCart(&cartPurchase{
+		command:          cmd.CommandPath(),
+		cartOID:          result.CartOID,
+		paymentMethodOID: paymentMethodOID,
+		subscriptionOID:  subscriptionOID,
+		servers:          result.Servers,
+		overrideBudget:   overrideBudget,
+	})
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Bought = true
+		cart.Entries = []CartEntry{}
+		if err = saveCart(run.CartPath, cart); err != nil {
+			run.OutputError(fmt.Errorf("cart bought but not emptied: %w", err))
+		}
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+	} else if !result.Bought {
+		run.OutputError(fmt.Errorf("purchase failed, the cart is unchanged: %s", result.Error))
+	} else {
+		fmt.Printf("%s cart bought for %s TTC\n", run.Colorize("Success:", "green"), formatMoney(price.TTC, DefaultCurrency))
+	}
+	if !result.Bought {
+		os.Exit(1)
+	}
+}
+
+// buildCart puts every entry of the local cart in a new API cart and prices it. Each
+// entry is also priced alone, in a cart of its own that is never bought. The API cart
+// must add up to its entries before discount: otherwise it does not hold exactly the
+// entries and is not to be bought.
+func (run *RunMiddleware) buildCart(cart *Cart) (*CartPriceResult, error) {
+	result := &CartPriceResult{Entries: make([]CartEntryPrice, 0, len(cart.Entries)), Currency: DefaultCurrency}
+	var initial int64
+	for i, entry := range cart.Entries {
+		if entry.Type != CartEntryServer {
+			return nil, fmt.Errorf("item %d: unknown type '%s'", i+1, entry.Type)
+		}
+		info := CreateServerInfo{
+			plan:        entry.Plan,
+			templateOID: entry.TemplateOID,
+			sshKeysName: entry.SSHKeys,
+			quantity:    entry.Quantity,
+			cpu:         entry.CPU,
+			ram:         entry.RAM,
+			disk:        entry.Disk,
+		}
+		serverCart, err := run.buildServerCart(&info)
+		if err != nil {
+			return nil, fmt.Errorf("item %d (%s): %w", i+1, entry.describe(), err)
+		}
+		price, err := run.priceCart(serverCart)
+		if err != nil {
+			return nil, fmt.Errorf("item %d (%s): %w", i+1, entry.describe(), err)
+		}
+
+		serverCart.CartOID = result.CartOID
+		cartOID, err := run.API.CreateServerCart(serverCart)
+		if err != nil {
+			return nil, fmt.Errorf("item %d (%s): %w", i+1, entry.describe(), err)
+		}
+		if result.CartOID != "" && cartOID != result.CartOID {
+			return nil, fmt.Errorf("item %d (%s): the API put it in cart %s instead of cart %s", i+1, entry.describe(), cartOID, result.CartOID)
+		}
+		result.CartOID = cartOID
+
+		result.Entries = append(result.Entries, CartEntryPrice{Index: i + 1, Entry: entry, Amount: *price, Description: entry.describe()})
+		result.Servers += entry.servers()
+		initial += price.Initial
+	}
+
+	price, err := run.API.GetCartPrice(result.CartOID)
+	if err != nil {
+		return nil, err
+	}
+	if price.Amount.Initial != initial {
+		return nil, fmt.Errorf("cart %s does not hold exactly the items: it is priced %s before discount, the items add up to %s",
+			result.CartOID, formatMoney(price.Amount.Initial, DefaultCurrency), formatMoney(initial, DefaultCurrency))
+	}
+	result.HT, result.TVA, result.TTC = price.Amount.HT, price.Amount.TVA, price.Amount.TTC
+	if price.Amount.Initial > price.Amount.HT {
+		result.Discount = price.Amount.Initial - price.Amount.HT
+	}
+	return result, nil
+}
+
+func (run *RunMiddleware) printCartPrice(result *CartPriceResult) {
+	table := NewTable("#", "DESCRIPTION", "QUANTITY", "PRICE (HT)", "PRICE (TTC)")
+	table.SetNoColor(!run.Color)
+	for _, entry := range result.Entries {
+		table.AddRow(
+			Col(strconv.Itoa(entry.Index)),
+			ColName(entry.Description),
+			ColCount(strconv.Itoa(entry.Entry.Quantity)),
+			Col(formatMoney(entry.Amount.HT, result.Currency)),
+			Col(formatMoney(entry.Amount.TTC, result.Currency)),
+		)
+	}
+	table.Print()
+
+	if result.Discount > 0 {
+		fmt.Printf("  %-10s %s\n", "Discount:", formatMoney(-result.Discount, result.Currency))
+	}
+	fmt.Printf("  %-10s %s\n", "Total HT:", formatMoney(result.HT, result.Currency))
+	fmt.Printf("  %-10s %s\n", "VAT (TVA):", formatMoney(result.TVA, result.Currency))
+	fmt.Printf("  %-10s %s\n", "Total TTC:", run.Colorize(formatMoney(result.TTC, result.Currency), "green"))
+}
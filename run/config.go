@@ -0,0 +1,22 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ConfigDir returns the directory of the configuration file, where the cart and the
+// purchase log are kept too: %APPDATA%\titan on Windows, ~/.titan otherwise
+func ConfigDir() string {
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "titan")
+		}
+		return "."
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".titan")
+	}
+	return "."
+}
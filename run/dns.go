@@ -0,0 +1,210 @@
+package run
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultDNSTTL is the $TTL of generated zones
+const DefaultDNSTTL = 3600
+
+// DNSRecord is a resource record of a generated zone
+type DNSRecord struct {
+	Name      string `json:"name"` // Relative to the origin for A/AAAA, absolute for PTR
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	ServerOID string `json:"server_oid"`
+}
+
+// DNSZoneResult is returned as JSON by 'dns zone'
+type DNSZoneResult struct {
+	Origin          string      `json:"origin"`
+	TTL             int         `json:"ttl"`
+	Records         []DNSRecord `json:"records"`
+	PTR             []DNSRecord `json:"ptr,omitempty"`
+	ReverseCommands []string    `json:"reverse_commands,omitempty"`
+}
+
+// serverIP is an IP address attached to a server, with its current reverse when known
+type serverIP struct {
+	Address string
+	Version int
+	Reverse string
+}
+
+// DNSZone generates A/AAAA records for the servers names and IP addresses.
+// Optionally, it also generates the matching PTR records, or the 'ip reverse set'
+// commands needed to make the reverses consistent with the zone.
+func (run *RunMiddleware) DNSZone(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	origin, _ := cmd.Flags().GetString("origin")
+	ttl, _ := cmd.Flags().GetInt("ttl")
+	withPTR, _ := cmd.Flags().GetBool("ptr")
+	reverseCommands, _ := cmd.Flags().GetBool("reverse-commands")
+	origin = strings.ToLower(strings.Trim(origin, "."))
+
+	companyOID, servers, err := run.fleetServers(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	ips, err := run.API.GetCompanyIPList(companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	// Commands only name the company when it is not the default one, and 'ip reverse set'
+	// then needs --company-oid
+	companyFlag := ""
+	if cmd.Flags().Changed("company-oid") {
+		companyFlag = " --company-oid " + companyOID
+	}
+	result := DNSZoneResult{Origin: origin, TTL: ttl, Records: []DNSRecord{}}
+	hostnames := serverHostnames(servers)
+	sort.Slice(servers, func(i, j int) bool {
+		return hostnames[servers[i].OID] < hostnames[servers[j].OID]
+	})
+	for i := range servers {
+		label := dnsLabel(hostnames[servers[i].OID])
+		fqdn := label + "." + origin
+		for _, ip := range serverIPs(&servers[i], ips) {
+			recordType := "A"
+			if ip.Version == 6 {
+				recordType = "AAAA"
+			}
+			result.Records = append(result.Records, DNSRecord{Name: label, Type: recordType, Value: ip.Address, ServerOID: servers[i].OID})
+
+			ptrName, err := reverseName(ip.Address)
+			if err != nil {
+				continue
+			}
+			result.PTR = append(result.PTR, DNSRecord{Name: ptrName, Type: "PTR", Value: fqdn + ".", ServerOID: servers[i].OID})
+			if !sameHostname(ip.Reverse, fqdn) {
+				result.ReverseCommands = append(result.ReverseCommands,
+					fmt.Sprintf("%s ip reverse set%s --ip %s --reverse %s", cmd.Root().Name(), companyFlag, ip.Address, fqdn))
+			}
+		}
+	}
+	if !withPTR {
+		result.PTR = nil
+	}
+	if !reverseCommands {
+		result.ReverseCommands = nil
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+		return
+	}
+	if reverseCommands {
+		// Only the commands are printed so that the output can be piped to a shell
+		for _, command := range result.ReverseCommands {
+			fmt.Println(command)
+		}
+		return
+	}
+	fmt.Print(renderZone(companyOID, result))
+}
+
+// renderZone renders the records in zone file format
+func renderZone(companyOID string, zone DNSZoneResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "; Generated by titan-sc for company %s\n", companyOID)
+	fmt.Fprintf(&b, "$ORIGIN %s.\n$TTL %d\n", zone.Origin, zone.TTL)
+	for _, record := range zone.Records {
+		fmt.Fprintf(&b, "%s\tIN\t%s\t%s\n", record.Name, record.Type, record.Value)
+	}
+	if len(zone.PTR) > 0 {
+		b.WriteString("\n; PTR records, to add to the reverse zones\n")
+		for _, record := range zone.PTR {
+			fmt.Fprintf(&b, "%s\tIN\tPTR\t%s\n", record.Name, record.Value)
+		}
+	}
+	return b.String()
+}
+
+// serverIPs returns the IP addresses of a server from its MAC sub-items and from the
+// company IP list (which also provides the current reverses), IPv4 first
+func serverIPs(server *api.ServerDetail, companyIPs []api.IP) []serverIP {
+	var result []serverIP
+	seen := map[string]int{}
+	add := func(ip *api.IP) {
+		parsed := net.ParseIP(ip.Address)
+		if parsed == nil {
+			return
+		}
+		address := parsed.String()
+		if i, ok := seen[address]; ok {
+			if result[i].Reverse == "" {
+				result[i].Reverse = ip.Reverse
+			}
+			return
+		}
+		version := 4
+		if parsed.To4() == nil {
+			version = 6
+		}
+		seen[address] = len(result)
+		result = append(result, serverIP{Address: address, Version: version, Reverse: ip.Reverse})
+	}
+
+	for _, item := range server.Items.MAC.SubItems {
+		if item.IP != nil {
+			add(item.IP)
+		}
+	}
+	for i := range companyIPs {
+		if companyIPs[i].ServerOID == server.OID {
+			add(&companyIPs[i])
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// reverseName returns the absolute PTR name of an IP address
+// (in-addr.arpa for IPv4, nibble format in ip6.arpa for IPv6)
+func reverseName(address string) (string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address '%s'", address)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[ip[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String(), nil
+}
+
+// dnsLabel makes a host alias usable as a DNS label: lowercase letters, digits and '-'
+func dnsLabel(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// sameHostname compares two host names, ignoring case and the trailing dot
+func sameHostname(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
@@ -0,0 +1,117 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeFileAtomic writes data to a temporary file in the same directory, then renames it
+// over path so that readers never see a partially written file.
+// Missing parent directories are created with mode 0700.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// replaceManagedBlock replaces the lines between the begin and end markers (included)
+// with block, leaving the rest of content untouched. The block is appended when the
+// markers are not found.
+func replaceManagedBlock(content, begin, end, block string) (string, error) {
+	start := strings.Index(content, begin)
+	if start < 0 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		return content + block, nil
+	}
+
+	stop := strings.Index(content[start:], end)
+	if stop < 0 {
+		return "", fmt.Errorf("found '%s' without matching '%s', fix the file manually", begin, end)
+	}
+	stop += start + len(end)
+	// Also consume the end of the marker line
+	if i := strings.IndexByte(content[stop:], '\n'); i >= 0 {
+		stop += i + 1
+	} else {
+		stop = len(content)
+	}
+	return content[:start] + block + content[stop:], nil
+}
+
+// companyBlockMarkers returns the lines delimiting the managed block of a company
+// in a file shared with the user (ssh config, hosts file)
+func companyBlockMarkers(companyOID string) (string, string) {
+	return fmt.Sprintf("# >>> titan-sc company %s >>>", companyOID),
+		fmt.Sprintf("# <<< titan-sc company %s <<<", companyOID)
+}
+
+// expandHome replaces a leading "~/" with the user home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// updateFile atomically replaces the content of path, only if it changed.
+// The mode of an existing file is kept, perm is the mode of a new one.
+func updateFile(path, content string, perm os.FileMode) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if err == nil && string(current) == content {
+		return false, nil
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return true, writeFileAtomic(path, []byte(content), perm)
+}
+
+// updateManagedFile replaces the company managed block of path with block,
+// leaving the rest of the file untouched
+func updateManagedFile(path, companyOID, block string, perm os.FileMode) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	begin, end := companyBlockMarkers(companyOID)
+	updated, err := replaceManagedBlock(string(current), begin, end, block)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return updateFile(path, updated, perm)
+}
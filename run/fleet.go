@@ -0,0 +1,180 @@
+package run
+
+import (
+	"sort"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// fleetServers returns the servers of the company given by --company-oid (default
+// company otherwise) matching --selector (if any). Servers listed without their
+// authentication or IP addresses are completed with their detail.
+func (run *RunMiddleware) fleetServers(cmd *cobra.Command) (string, []api.ServerDetail, error) {
+	var selector *ServerSelector
+	if expr, _ := cmd.Flags().GetString("selector"); expr != "" {
+		var err error
+		if selector, err = ParseServerSelector(expr); err != nil {
+			return "", nil, err
+		}
+	}
+
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		return "", nil, err
+	}
+	servers, apiReturn, err := run.API.ServerList(companyOID)
+	if err != nil {
+		return "", nil, err
+	}
+	if apiReturn != nil && apiReturn.Error() {
+		return "", nil, apiReturn.AsError()
+	}
+	if selector != nil {
+		servers = selector.Filter(servers)
+	}
+
+	if err = run.completeServerDetails(servers); err != nil {
+		return "", nil, err
+	}
+	return companyOID, servers, nil
+}
+
+// completeServerDetails replaces the servers listed without their authentication or
+// IP addresses by their detail
+func (run *RunMiddleware) completeServerDetails(servers []api.ServerDetail) error {
+	for i := range servers {
+		if servers[i].Authentication != nil && len(servers[i].Items.MAC.SubItems) > 0 {
+			continue
+		}
+		server, apiReturn, err := run.API.GetServerOID(servers[i].OID)
+		if err != nil {
+			return err
+		}
+		if apiReturn != nil && apiReturn.Error() {
+			return apiReturn.AsError()
+		}
+		servers[i] = *server
+	}
+	return nil
+}
+
+// FleetHost describes a server for inventory outputs (Ansible, Prometheus, hosts file)
+type FleetHost struct {
+	Hostname    string   `json:"hostname"` // Unique host alias derived from the server name
+	Name        string   `json:"name"`
+	ServerOID   string   `json:"server_oid"`
+	UUID        string   `json:"uuid"`
+	CompanyOID  string   `json:"company_oid"`
+	Address     string   `json:"address"`      // Primary IPv4, or primary IPv6 without IPv4
+	IPv4Address string   `json:"ipv4_address"` // Primary IPv4
+	IPv6Address string   `json:"ipv6_address"` // Primary IPv6
+	User        string   `json:"user"`
+	Plan        string   `json:"plan"`
+	OS          string   `json:"os"`
+	OSVersion   string   `json:"os_version"`
+	Site        string   `json:"site"`
+	State       string   `json:"state"`
+	Drp         string   `json:"drp"`
+	Tags        []string `json:"tags"`
+	IPv4        []string `json:"ipv4"`
+	IPv6        []string `json:"ipv6"`
+	Networks    []string `json:"networks"`
+}
+
+// fleetHosts returns the servers selected like fleetServers, described as FleetHost
+// (including their private network membership), sorted by hostname
+func (run *RunMiddleware) fleetHosts(cmd *cobra.Command) (string, []FleetHost, error) {
+	companyOID, servers, err := run.fleetServers(cmd)
+	if err != nil {
+		return "", nil, err
+	}
+
+	networkList, err := run.API.GetNetworkList(companyOID)
+	if err != nil {
+		return "", nil, err
+	}
+	serverNetworks := map[string][]string{}
+	for _, network := range networkList.Networks {
+		for _, iface := range network.Interfaces {
+			serverNetworks[iface.Server.OID] = append(serverNetworks[iface.Server.OID], network.Name)
+		}
+	}
+
+	hostnames := serverHostnames(servers)
+	hosts := make([]FleetHost, 0, len(servers))
+	for i := range servers {
+		server := &servers[i]
+		host := FleetHost{
+			Hostname:   hostnames[server.OID],
+			Name:       server.Name,
+			ServerOID:  server.OID,
+			UUID:       server.UUID,
+			CompanyOID: server.Company,
+			Plan:       server.Items.CPU.Plan,
+			Site:       mapSiteToPublic(server.Site),
+			State:      serverState(server),
+			Drp:        serverDrpSelectorValue(server),
+			Tags:       []string{},
+			IPv4:       []string{},
+			IPv6:       []string{},
+			Networks:   []string{},
+		}
+		if host.CompanyOID == "" {
+			host.CompanyOID = companyOID
+		}
+		if template := server.Items.OS.Template; template != nil {
+			host.OS = template.OS
+			host.OSVersion = template.Version
+		}
+		if server.Authentication != nil {
+			host.User = server.Authentication.UserLogin
+		}
+		for _, tag := range server.TagInfo {
+			host.Tags = append(host.Tags, tag.Name)
+		}
+		for _, item := range server.Items.MAC.SubItems {
+			if item.IP == nil {
+				continue
+			}
+			if item.IP.Version == 6 {
+				host.IPv6 = append(host.IPv6, item.IP.Address)
+			} else {
+				host.IPv4 = append(host.IPv4, item.IP.Address)
+			}
+		}
+		host.IPv4Address = serverPrimaryIP(server, 4)
+		host.IPv6Address = serverPrimaryIP(server, 6)
+		if host.Address = host.IPv4Address; host.Address == "" {
+			host.Address = host.IPv6Address
+		}
+		if networks, ok := serverNetworks[server.OID]; ok {
+			host.Networks = networks
+		}
+		hosts = append(hosts, host)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Hostname < hosts[j].Hostname
+	})
+	return companyOID, hosts, nil
+}
+
+// serverHostnames returns a unique host alias per server OID, derived from the
+// server name. Servers sharing a name are disambiguated with their OID.
+func serverHostnames(servers []api.ServerDetail) map[string]string {
+	count := make(map[string]int, len(servers))
+	for _, server := range servers {
+		count[sshHostAlias(server.Name)]++
+	}
+	hostnames := make(map[string]string, len(servers))
+	for _, server := range servers {
+		alias := sshHostAlias(server.Name)
+		if count[alias] > 1 || alias == "" {
+			alias = strings.Trim(alias+"-"+server.OID, "-")
+		}
+		hostnames[server.OID] = alias
+	}
+	return hostnames
+}
@@ -0,0 +1,307 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// ansibleGroup is a group of the Ansible dynamic inventory
+type ansibleGroup struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children,omitempty"`
+}
+
+// InventoryAnsible implements the Ansible dynamic inventory protocol:
+// --list prints all groups with hostvars in _meta, --host prints the hostvars of one host.
+// The output is always JSON, as expected by Ansible.
+func (run *RunMiddleware) InventoryAnsible(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	list, _ := cmd.Flags().GetBool("list")
+	hostname, _ := cmd.Flags().GetString("host")
+	if !list && hostname == "" {
+		run.OutputErrorAndExit(errors.New("either --list or --host is required"))
+	}
+
+	_, hosts, err := run.fleetHosts(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	if !list {
+		for _, host := range hosts {
+			if host.Hostname == hostname {
+				printAsJson(ansibleHostVars(host))
+				return
+			}
+		}
+		// Unknown hosts have no variables
+		printAsJson(map[string]interface{}{})
+		return
+	}
+
+	inventory := map[string]interface{}{}
+	groups := map[string]*ansibleGroup{}
+	hostvars := map[string]interface{}{}
+	all := &ansibleGroup{Hosts: []string{}}
+	for _, host := range hosts {
+		all.Hosts = append(all.Hosts, host.Hostname)
+		hostvars[host.Hostname] = ansibleHostVars(host)
+		for _, name := range ansibleHostGroups(host) {
+			if groups[name] == nil {
+				groups[name] = &ansibleGroup{}
+			}
+			groups[name].Hosts = append(groups[name].Hosts, host.Hostname)
+		}
+	}
+	for name, group := range groups {
+		all.Children = append(all.Children, name)
+		inventory[name] = group
+	}
+	sort.Strings(all.Children)
+	inventory["all"] = all
+	inventory["_meta"] = map[string]interface{}{"hostvars": hostvars}
+	printAsJson(inventory)
+}
+
+// ansibleHostVars returns the variables of a host: connection settings and titan_* facts
+func ansibleHostVars(host FleetHost) map[string]interface{} {
+	vars := map[string]interface{}{
+		"titan_name":        host.Name,
+		"titan_oid":         host.ServerOID,
+		"titan_uuid":        host.UUID,
+		"titan_company_oid": host.CompanyOID,
+		"titan_plan":        host.Plan,
+		"titan_os":          host.OS,
+		"titan_os_version":  host.OSVersion,
+		"titan_site":        host.Site,
+		"titan_state":       host.State,
+		"titan_drp":         host.Drp,
+		"titan_tags":        host.Tags,
+		"titan_ipv4":        host.IPv4,
+		"titan_ipv6":        host.IPv6,
+		"titan_networks":    host.Networks,
+	}
+	if host.Address != "" {
+		vars["ansible_host"] = host.Address
+	}
+	if host.User != "" {
+		vars["ansible_user"] = host.User
+	}
+	return vars
+}
+
+// ansibleHostGroups returns the groups of a host, derived from its plan, OS, site,
+// tags, DRP state and private networks (e.g. plan_sc2, os_debian_12, tag_web)
+func ansibleHostGroups(host FleetHost) []string {
+	var groups []string
+	add := func(parts ...string) {
+		name := ansibleGroupName(strings.Join(parts, "_"))
+		if name != "" && !containsString(groups, name) {
+			groups = append(groups, name)
+		}
+	}
+	if host.Plan != "" {
+		add("plan", host.Plan)
+	}
+	if host.OS != "" {
+		add("os", host.OS)
+		if host.OSVersion != "" {
+			add("os", host.OS, host.OSVersion)
+		}
+	}
+	if host.Site != "" {
+		add("site", host.Site)
+	}
+	for _, tag := range host.Tags {
+		add("tag", tag)
+	}
+	add("drp", host.Drp)
+	for _, network := range host.Networks {
+		add("network", network)
+	}
+	return groups
+}
+
+// ansibleGroupName makes a valid Ansible group name: lowercase letters, digits and '_'
+func ansibleGroupName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+const (
+	// DefaultInventoryWatchInterval is the refresh interval of inventory files with --watch
+	DefaultInventoryWatchInterval = time.Minute
+	// DefaultPrometheusPort is the node exporter port
+	DefaultPrometheusPort = 9100
+)
+
+// prometheusTargetGroup is an entry of a Prometheus file_sd file
+type prometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// InventoryFileResult is returned as JSON when an inventory file is written
+type InventoryFileResult struct {
+	File    string `json:"file"`
+	Entries int    `json:"entries"`
+	Changed bool   `json:"changed"`
+}
+
+// InventoryPrometheusSD generates a Prometheus file_sd file, one target group per
+// server with its name, OID, plan, site and tags as labels
+func (run *RunMiddleware) InventoryPrometheusSD(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	ports, _ := cmd.Flags().GetIntSlice("port")
+
+	run.inventoryOutput(cmd, false, func(_ string, hosts []FleetHost) (string, int) {
+		groups := make([]prometheusTargetGroup, 0, len(hosts))
+		for _, host := range hosts {
+			if host.Address == "" {
+				continue
+			}
+			group := prometheusTargetGroup{
+				Labels: map[string]string{
+					"titan_name": host.Name,
+					"titan_oid":  host.ServerOID,
+					"titan_plan": host.Plan,
+					"titan_site": host.Site,
+					// Surrounding commas allow matching a single tag with ".*,tag,.*"
+					"titan_tags": "," + strings.Join(host.Tags, ",") + ",",
+				},
+			}
+			for _, port := range ports {
+				group.Targets = append(group.Targets, net.JoinHostPort(host.Address, strconv.Itoa(port)))
+			}
+			groups = append(groups, group)
+		}
+		data, _ := json.MarshalIndent(groups, "", "  ")
+		return string(data) + "\n", len(groups)
+	})
+}
+
+// InventoryHosts generates /etc/hosts lines for the servers primary IPs.
+// Written to a file, the lines go into a managed block of the company.
+func (run *RunMiddleware) InventoryHosts(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	domain, _ := cmd.Flags().GetString("domain")
+	ipv6, _ := cmd.Flags().GetBool("ipv6")
+	domain = strings.Trim(domain, ".")
+
+	run.inventoryOutput(cmd, true, func(companyOID string, hosts []FleetHost) (string, int) {
+		begin, end := companyBlockMarkers(companyOID)
+		var b strings.Builder
+		b.WriteString(begin + "\n")
+		entries := 0
+		for _, host := range hosts {
+			names := host.Hostname
+			if domain != "" {
+				names = host.Hostname + "." + domain + " " + host.Hostname
+			}
+			addresses := []string{host.IPv4Address}
+			if ipv6 {
+				addresses = append(addresses, host.IPv6Address)
+			}
+			for _, address := range addresses {
+				if address == "" {
+					continue
+				}
+				fmt.Fprintf(&b, "%s\t%s\n", address, names)
+				entries++
+			}
+		}
+		b.WriteString(end + "\n")
+		return b.String(), entries
+	})
+}
+
+// inventoryOutput prints the content generated by render, or writes it to --output
+// (into the company managed block when managedBlock is set).
+// With --watch, the servers are fetched again every --interval and the file is
+// rewritten atomically whenever its content changes.
+func (run *RunMiddleware) inventoryOutput(cmd *cobra.Command, managedBlock bool,
+	render func(companyOID string, hosts []FleetHost) (string, int)) {
+	output, _ := cmd.Flags().GetString("output")
+	watch, _ := cmd.Flags().GetBool("watch")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if watch && output == "" {
+		run.OutputErrorAndExit(errors.New("--watch requires --output"))
+	}
+	if interval <= 0 {
+		interval = DefaultInventoryWatchInterval
+	}
+
+	var err error
+	if output, err = expandHome(output); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	for first := true; ; first = false {
+		if !first {
+			time.Sleep(interval)
+		}
+
+		companyOID, hosts, err := run.fleetHosts(cmd)
+		if err != nil {
+			if !watch {
+				run.OutputErrorAndExit(err)
+			}
+			// Keep the previous file on transient errors
+			run.OutputError(err)
+			continue
+		}
+		content, entries := render(companyOID, hosts)
+		if output == "" {
+			fmt.Print(content)
+			return
+		}
+
+		result := InventoryFileResult{File: output, Entries: entries}
+		if managedBlock {
+			result.Changed, err = updateManagedFile(output, companyOID, content, 0644)
+		} else {
+			result.Changed, err = updateFile(output, content, 0644)
+		}
+		if err != nil {
+			if !watch {
+				run.OutputErrorAndExit(err)
+			}
+			run.OutputError(err)
+			continue
+		}
+
+		if first || result.Changed {
+			if run.JSONOutput {
+				printAsJson(result)
+			} else if result.Changed {
+				fmt.Printf("%s %s %d entries written to %s\n", time.Now().Format(time.DateTime),
+					run.Colorize("Success:", "green"), entries, output)
+			} else {
+				fmt.Printf("%s %s %s is up to date (%d entries)\n", time.Now().Format(time.DateTime),
+					run.Colorize("Success:", "green"), output, entries)
+			}
+		}
+		if !watch {
+			return
+		}
+	}
+}
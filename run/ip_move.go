@@ -0,0 +1,198 @@
+package run
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultIPMoveTimeout is how long 'ip move' waits for the IP to show up on the target server
+const DefaultIPMoveTimeout = time.Minute
+
+// IPMoveResult is returned as JSON by 'ip move'
+type IPMoveResult struct {
+	IP             string `json:"ip"`
+	FromServerOID  string `json:"from_server_oid,omitempty"`
+	FromServerName string `json:"from_server_name,omitempty"`
+	ToServerOID    string `json:"to_server_oid"`
+	ToServerName   string `json:"to_server_name"`
+	Success        bool   `json:"success"`
+	RolledBack     bool   `json:"rolled_back"`
+	Error          string `json:"error,omitempty"`
+}
+
+// IPMove moves an IP from its current server to another one: detach, attach and
+// verify. If the attach or the verification fails, the IP is attached back to its
+// original server so that it is never left orphaned.
+func (run *RunMiddleware) IPMove(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	address, _ := cmd.Flags().GetString("ip")
+	toServer, _ := cmd.Flags().GetString("to-server")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	ips, err := run.API.GetCompanyIPList(companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	ip := findCompanyIP(ips, address)
+	if ip == nil {
+		run.OutputErrorAndExit(fmt.Errorf("IP %s not found in company %s", address, companyOID))
+	}
+	target, err := run.resolveServer(cmd, toServer)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if ip.ServerOID == target.OID {
+		run.OutputErrorAndExit(fmt.Errorf("IP %s is already attached to server %s", ip.Address, target.Name))
+	}
+
+	result := IPMoveResult{
+		IP:             net.ParseIP(ip.Address).String(),
+		FromServerOID:  ip.ServerOID,
+		FromServerName: ip.ServerName,
+		ToServerOID:    target.OID,
+		ToServerName:   target.Name,
+	}
+	from := "unattached"
+	if ip.ServerOID != "" {
+		from = fmt.Sprintf("server %s (%s)", ip.ServerName, ip.ServerOID)
+	}
+	question := fmt.Sprintf("Move IP %s from %s to server %s (%s)?", result.IP, from, target.Name, target.OID)
+	if err = run.confirmAction(cmd, question); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	if err = run.moveIP(companyOID, &result, timeout); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+	} else if result.Success {
+		fmt.Printf("%s IP %s moved to server %s\n", run.Colorize("Success:", "green"), result.IP, run.Colorize(target.Name, "cyan"))
+	} else {
+		run.OutputError(err)
+	}
+	if !result.Success {
+		os.Exit(1)
+	}
+}
+
+// moveIP runs the detach/attach/verify steps, rolling back on failure
+func (run *RunMiddleware) moveIP(companyOID string, result *IPMoveResult, timeout time.Duration) error {
+	if result.FromServerOID != "" {
+		run.printIPMoveStep("Detaching %s from %s...", result.IP, result.FromServerName)
+		apiReturn, err := run.API.IPDetach(result.FromServerOID, []string{result.IP})
+		if err = apiCallError(apiReturn, err); err != nil {
+			// Nothing has changed yet
+			return fmt.Errorf("detach from %s failed, IP left in place: %w", result.FromServerName, err)
+		}
+	}
+
+	run.printIPMoveStep("Attaching %s to %s...", result.IP, result.ToServerName)
+	apiReturn, err := run.API.IPAttach(result.ToServerOID, []string{result.IP})
+	if err = apiCallError(apiReturn, err); err != nil {
+		return run.rollbackIPMove(result, false, fmt.Errorf("attach to %s failed: %w", result.ToServerName, err))
+	}
+
+	run.printIPMoveStep("Verifying %s is attached to %s...", result.IP, result.ToServerName)
+	if err = run.waitIPOwner(companyOID, result.IP, result.ToServerOID, timeout); err != nil {
+		return run.rollbackIPMove(result, true, err)
+	}
+	return nil
+}
+
+// rollbackIPMove attaches the IP back to its original server after cause.
+// With attached, the IP is first detached from the target server.
+func (run *RunMiddleware) rollbackIPMove(result *IPMoveResult, attached bool, cause error) error {
+	if result.FromServerOID == "" {
+		if attached {
+			run.printIPMoveStep("Rolling back: detaching %s from %s...", result.IP, result.ToServerName)
+			apiReturn, err := run.API.IPDetach(result.ToServerOID, []string{result.IP})
+			if err = apiCallError(apiReturn, err); err != nil {
+				return fmt.Errorf("%w; rollback failed, detach it with '%s': %v", cause,
+					fmt.Sprintf("ip detach --server-oid %s --ip %s", result.ToServerOID, result.IP), err)
+			}
+			result.RolledBack = true
+		}
+		return cause
+	}
+
+	if attached {
+		run.printIPMoveStep("Rolling back: detaching %s from %s...", result.IP, result.ToServerName)
+		// Best effort: the attach back below reports the failure if the IP is still there
+		_, _ = run.API.IPDetach(result.ToServerOID, []string{result.IP})
+	}
+	run.printIPMoveStep("Rolling back: attaching %s to %s...", result.IP, result.FromServerName)
+	apiReturn, err := run.API.IPAttach(result.FromServerOID, []string{result.IP})
+	if err = apiCallError(apiReturn, err); err != nil {
+		return fmt.Errorf("%w; rollback failed, IP %s is orphaned, attach it with '%s': %v", cause, result.IP,
+			fmt.Sprintf("ip attach --server-oid %s --ip %s", result.FromServerOID, result.IP), err)
+	}
+	result.RolledBack = true
+	return fmt.Errorf("%w; IP %s attached back to %s", cause, result.IP, result.FromServerName)
+}
+
+// waitIPOwner polls the company IPs until address is attached to serverOID
+func (run *RunMiddleware) waitIPOwner(companyOID, address, serverOID string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultIPMoveTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	delay := time.Second
+	for {
+		ips, err := run.API.GetCompanyIPList(companyOID)
+		if err != nil {
+			return err
+		}
+		ip := findCompanyIP(ips, address)
+		if ip == nil {
+			return fmt.Errorf("IP %s disappeared from company %s", address, companyOID)
+		}
+		if ip.ServerOID == serverOID {
+			return nil
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			owner := ip.ServerOID
+			if owner == "" {
+				owner = "none"
+			}
+			return fmt.Errorf("IP %s not attached to server %s after %s (current server: %s)", address, serverOID, timeout, owner)
+		}
+		time.Sleep(delay)
+		delay = delay * 3 / 2
+		if delay > waitMaxDelay {
+			delay = waitMaxDelay
+		}
+	}
+}
+
+func (run *RunMiddleware) printIPMoveStep(format string, a ...interface{}) {
+	if !run.JSONOutput {
+		fmt.Printf(format+"\n", a...)
+	}
+}
+
+// apiCallError returns the error of an API call that reports failures either as
+// an error or as an error Return
+func apiCallError(apiReturn *api.Return, err error) error {
+	if err != nil {
+		return err
+	}
+	if apiReturn != nil && apiReturn.Error() {
+		return apiReturn.AsError()
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package run
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// ReverseEntry is a desired reverse DNS, as read from a reverse file
+type ReverseEntry struct {
+	IP      string `json:"ip" yaml:"ip"`
+	Reverse string `json:"reverse" yaml:"reverse"`
+}
+
+// ReverseChange is a reverse DNS update computed by 'ip reverse apply'
+type ReverseChange struct {
+	IP         string `json:"ip"`
+	IPOID      string `json:"-"`
+	ServerName string `json:"server_name,omitempty"`
+	Current    string `json:"current"`
+	Desired    string `json:"desired"`
+	Applied    bool   `json:"applied"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReverseApplyResult is returned as JSON by 'ip reverse apply'
+type ReverseApplyResult struct {
+	DryRun    bool            `json:"dry_run"`
+	Changes   []ReverseChange `json:"changes"`
+	Unchanged int             `json:"unchanged"`
+}
+
+// reversePatternPlaceholders are the placeholders supported by --pattern
+var reversePatternPlaceholders = []string{"{server}", "{site}", "{plan}", "{oid}", "{ip}"}
+
+// IPReverseApply sets the reverse DNS of many IPs at once, from a CSV/YAML file
+// (-f) or from a pattern applied to the IPs attached to servers (--pattern).
+// The differences between current and desired reverses are displayed before applying.
+func (run *RunMiddleware) IPReverseApply(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	file, _ := cmd.Flags().GetString("file")
+	pattern, _ := cmd.Flags().GetString("pattern")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	var companyOID string
+	var servers []api.ServerDetail
+	var err error
+	if pattern != "" {
+		// Servers are only needed to render the pattern
+		companyOID, servers, err = run.fleetServers(cmd)
+	} else {
+		companyOID, err = run.GetDefaultCompanyOID(cmd)
+	}
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	ips, err := run.API.GetCompanyIPList(companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	var desired []ReverseEntry
+	if pattern != "" {
+		desired, err = reversesFromPattern(pattern, servers, ips)
+	} else {
+		desired, err = loadReverseFile(file)
+	}
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	result := ReverseApplyResult{DryRun: dryRun, Changes: []ReverseChange{}}
+	if result.Changes, result.Unchanged, err = diffReverses(desired, ips); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	if !run.JSONOutput {
+		run.printReverseDiff(result)
+	}
+	if dryRun || len(result.Changes) == 0 {
+		if run.JSONOutput {
+			printAsJson(result)
+		}
+		return
+	}
+
+	question := fmt.Sprintf("Update the reverse DNS of %d IP(s)?", len(result.Changes))
+	if err = run.confirmAction(cmd, question); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	failed := 0
+	for i := range result.Changes {
+		change := &result.Changes[i]
+		if _, err := run.API.IPUpdateReverse(change.IPOID, change.Desired); err != nil {
+			change.Error = err.Error()
+			failed++
+			continue
+		}
+		change.Applied = true
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+	} else {
+		for _, change := range result.Changes {
+			if change.Error != "" {
+				fmt.Printf("%s %s: %s\n", run.Colorize("Error:", "red"), change.IP, change.Error)
+			}
+		}
+		if failed > 0 {
+			fmt.Printf("%s %d/%d reverse(s) failed\n", run.Colorize("Error:", "red"), failed, len(result.Changes))
+		} else {
+			fmt.Printf("%s %d/%d reverse(s) updated\n", run.Colorize("Success:", "green"), len(result.Changes), len(result.Changes))
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printReverseDiff displays the reverses to change
+func (run *RunMiddleware) printReverseDiff(result ReverseApplyResult) {
+	if len(result.Changes) == 0 {
+		fmt.Printf("%s all %d reverse(s) are up to date\n", run.Colorize("Success:", "green"), result.Unchanged)
+		return
+	}
+
+	table := NewTable("IP", "SERVER", "CURRENT", "DESIRED")
+	table.SetNoColor(!run.Color)
+	for _, change := range result.Changes {
+		var currentColorFn, desiredColorFn func(string) string
+		if run.Color {
+			currentColorFn = ColorFn("red")
+			desiredColorFn = ColorFn("green")
+		}
+		table.AddRow(
+			ColIP(change.IP),
+			ColName(change.ServerName),
+			ColColor(change.Current, currentColorFn),
+			ColColor(change.Desired, desiredColorFn),
+		)
+	}
+	table.Print()
+	fmt.Printf("%d change(s), %d unchanged\n", len(result.Changes), result.Unchanged)
+	if result.DryRun {
+		fmt.Println("Dry run: no reverse has been updated.")
+	}
+}
+
+// diffReverses compares desired reverses to the company IPs. All unknown IPs are
+// reported together. Returns the changes and the number of reverses already correct.
+func diffReverses(desired []ReverseEntry, ips []api.IP) ([]ReverseChange, int, error) {
+	changes := []ReverseChange{}
+	unchanged := 0
+	var problems []string
+	seen := map[string]string{}
+	for _, entry := range desired {
+		ip := findCompanyIP(ips, entry.IP)
+		if ip == nil {
+			problems = append(problems, fmt.Sprintf("IP %s not found in company", entry.IP))
+			continue
+		}
+		reverse := strings.TrimSuffix(strings.TrimSpace(entry.Reverse), ".")
+		if reverse == "" {
+			problems = append(problems, fmt.Sprintf("IP %s: empty reverse", entry.IP))
+			continue
+		}
+		if previous, ok := seen[ip.Address]; ok {
+			if previous != reverse {
+				problems = append(problems, fmt.Sprintf("IP %s: conflicting reverses %s and %s", ip.Address, previous, reverse))
+			}
+			continue
+		}
+		seen[ip.Address] = reverse
+
+		if sameHostname(ip.Reverse, reverse) {
+			unchanged++
+			continue
+		}
+		changes = append(changes, ReverseChange{
+			IP:         ip.Address,
+			IPOID:      ip.OID,
+			ServerName: ip.ServerName,
+			Current:    ip.Reverse,
+			Desired:    reverse,
+		})
+	}
+	if len(problems) > 0 {
+		return nil, 0, fmt.Errorf("invalid reverses:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return compareIPs(changes[i].IP, changes[j].IP) < 0
+	})
+	return changes, unchanged, nil
+}
+
+// reversesFromPattern renders the pattern for every IP attached to one of servers
+func reversesFromPattern(pattern string, servers []api.ServerDetail, ips []api.IP) ([]ReverseEntry, error) {
+	byOID := make(map[string]*api.ServerDetail, len(servers))
+	for i := range servers {
+		byOID[servers[i].OID] = &servers[i]
+	}
+	hostnames := serverHostnames(servers)
+
+	var entries []ReverseEntry
+	for _, ip := range ips {
+		server, ok := byOID[ip.ServerOID]
+		if !ok {
+			continue
+		}
+		reverse, err := renderReversePattern(pattern, server, hostnames[server.OID], ip.Address)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ReverseEntry{IP: ip.Address, Reverse: reverse})
+	}
+	return entries, nil
+}
+
+// renderReversePattern replaces the placeholders of pattern for an IP of server:
+// {server} (server name as DNS label), {site}, {plan}, {oid} and {ip} (dashed address)
+func renderReversePattern(pattern string, server *api.ServerDetail, hostname, address string) (string, error) {
+	replacer := strings.NewReplacer(
+		"{server}", dnsLabel(hostname),
+		"{site}", dnsLabel(mapSiteToPublic(server.Site)),
+		"{plan}", dnsLabel(server.Items.CPU.Plan),
+		"{oid}", dnsLabel(server.OID),
+		"{ip}", strings.Trim(strings.NewReplacer(".", "-", ":", "-").Replace(address), "-"),
+	)
+	reverse := replacer.Replace(pattern)
+	if strings.ContainsAny(reverse, "{}") {
+		return "", fmt.Errorf("invalid pattern '%s': supported placeholders are %s", pattern,
+			strings.Join(reversePatternPlaceholders, ", "))
+	}
+	if strings.Contains(reverse, "..") || strings.HasPrefix(reverse, ".") {
+		return "", fmt.Errorf("pattern '%s' gives an invalid reverse '%s' for server %s", pattern, reverse, server.Name)
+	}
+	return strings.ToLower(reverse), nil
+}
+
+// loadReverseFile reads desired reverses from a CSV file (ip,reverse per line, optional
+// header) or a YAML/JSON file (list of {ip, reverse} or map of ip: reverse)
+func loadReverseFile(path string) ([]ReverseEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return parseReverseCSV(string(data))
+	case ".yaml", ".yml", ".json":
+		var entries []ReverseEntry
+		if err = yaml.Unmarshal(data, &entries); err == nil {
+			return entries, nil
+		}
+		var byIP map[string]string
+		if yaml.Unmarshal(data, &byIP) != nil {
+			return nil, fmt.Errorf("%s: expected a list of {ip, reverse} or a map of ip: reverse: %w", path, err)
+		}
+		for ip, reverse := range byIP {
+			entries = append(entries, ReverseEntry{IP: ip, Reverse: reverse})
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported file format, use .csv, .yaml, .yml or .json", path)
+	}
+}
+
+func parseReverseCSV(data string) ([]ReverseEntry, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []ReverseEntry
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("CSV record %d: expected ip,reverse", line)
+		}
+		ip := strings.TrimSpace(record[0])
+		if line == 1 && net.ParseIP(ip) == nil {
+			// Header
+			continue
+		}
+		entries = append(entries, ReverseEntry{IP: ip, Reverse: strings.TrimSpace(record[1])})
+	}
+	return entries, nil
+}
+
+// findCompanyIP returns the company IP matching address, comparing parsed addresses
+// so that any IPv6 notation matches
+func findCompanyIP(ips []api.IP, address string) *api.IP {
+	parsed := net.ParseIP(strings.TrimSpace(address))
+	if parsed == nil {
+		return nil
+	}
+	for i := range ips {
+		if parsed.Equal(net.ParseIP(ips[i].Address)) {
+			return &ips[i]
+		}
+	}
+	return nil
+}
+
+// compareIPs orders IPv4 before IPv6, then by address
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	isIPv4A, isIPv4B := ipA.To4() != nil, ipB.To4() != nil
+	if isIPv4A != isIPv4B {
+		if isIPv4A {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16())
+}
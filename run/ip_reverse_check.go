@@ -0,0 +1,256 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// DefaultReverseCheckTimeout is the maximum duration of each forward lookup
+	DefaultReverseCheckTimeout = 5 * time.Second
+	// reverseCheckParallelism is the number of forward lookups run at once
+	reverseCheckParallelism = 10
+)
+
+// Reverse check statuses
+const (
+	ReverseStatusOK         = "ok"
+	ReverseStatusNoReverse  = "no_reverse"
+	ReverseStatusDefault    = "default_reverse"
+	ReverseStatusUnresolved = "unresolved"
+	ReverseStatusMismatch   = "mismatch"
+)
+
+// ReverseCheck is the forward-confirmed reverse DNS status of an IP
+type ReverseCheck struct {
+	IP         string   `json:"ip"`
+	ServerName string   `json:"server_name,omitempty"`
+	Reverse    string   `json:"reverse"`
+	Status     string   `json:"status"`
+	Resolved   []string `json:"resolved,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ReverseCheckResult is returned as JSON by 'ip reverse check'
+type ReverseCheckResult struct {
+	Resolver string         `json:"resolver"`
+	Checks   []ReverseCheck `json:"checks"`
+	Problems int            `json:"problems"`
+}
+
+// hostResolver resolves host names to IP addresses; *net.Resolver implements it
+type hostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// IPReverseCheck verifies that the reverse of each IP resolves back to the IP
+// (forward-confirmed reverse DNS), and flags missing or default reverses.
+// Exits with a non-zero status if any IP has a problem.
+func (run *RunMiddleware) IPReverseCheck(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	resolverAddress, _ := cmd.Flags().GetString("resolver")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	addresses, _ := cmd.Flags().GetStringSlice("ip")
+	includeUnattached, _ := cmd.Flags().GetBool("include-unattached")
+
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	companyIPs, err := run.API.GetCompanyIPList(companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	ips, err := reverseCheckTargets(companyIPs, addresses, includeUnattached)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	resolver, resolverName, err := newHostResolver(resolverAddress)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	result := ReverseCheckResult{Resolver: resolverName, Checks: checkReverses(resolver, ips, timeout)}
+	for _, check := range result.Checks {
+		if check.Status != ReverseStatusOK {
+			result.Problems++
+		}
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+	} else {
+		run.printReverseChecks(result)
+	}
+	if result.Problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// reverseCheckTargets returns the IPs to check: the given addresses, or every IP
+// attached to a server (every company IP with includeUnattached)
+func reverseCheckTargets(companyIPs []api.IP, addresses []string, includeUnattached bool) ([]api.IP, error) {
+	if len(addresses) == 0 {
+		var ips []api.IP
+		for _, ip := range companyIPs {
+			if includeUnattached || ip.ServerOID != "" {
+				ips = append(ips, ip)
+			}
+		}
+		return ips, nil
+	}
+
+	ips := make([]api.IP, 0, len(addresses))
+	var missing []string
+	for _, address := range addresses {
+		ip := findCompanyIP(companyIPs, address)
+		if ip == nil {
+			missing = append(missing, address)
+			continue
+		}
+		ips = append(ips, *ip)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("IP(s) not found in company: %s", strings.Join(missing, ", "))
+	}
+	return ips, nil
+}
+
+// newHostResolver returns the system resolver, or a resolver querying only the
+// DNS server at address (host or host:port, port 53 by default)
+func newHostResolver(address string) (hostResolver, string, error) {
+	if address == "" {
+		return net.DefaultResolver, "system", nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), "53")
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, "", fmt.Errorf("invalid resolver '%s': %w", address, err)
+	}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+	return resolver, address, nil
+}
+
+// checkReverses runs checkReverse on every IP, a few at a time. Results are sorted by IP.
+func checkReverses(resolver hostResolver, ips []api.IP, timeout time.Duration) []ReverseCheck {
+	checks := make([]ReverseCheck, len(ips))
+	sem := make(chan struct{}, reverseCheckParallelism)
+	var wg sync.WaitGroup
+	for i := range ips {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			checks[i] = checkReverse(resolver, &ips[i], timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return compareIPs(checks[i].IP, checks[j].IP) < 0
+	})
+	return checks
+}
+
+// checkReverse resolves the reverse of ip and verifies that it points back to ip
+func checkReverse(resolver hostResolver, ip *api.IP, timeout time.Duration) ReverseCheck {
+	expected := net.ParseIP(ip.Address)
+	check := ReverseCheck{IP: ip.Address, ServerName: ip.ServerName, Reverse: ip.Reverse}
+	if expected != nil {
+		check.IP = expected.String()
+	}
+	reverse := strings.TrimSuffix(ip.Reverse, ".")
+	switch {
+	case reverse == "":
+		check.Status = ReverseStatusNoReverse
+		return check
+	case ip.DefaultReverse != "" && sameHostname(reverse, ip.DefaultReverse):
+		check.Status = ReverseStatusDefault
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := resolver.LookupIPAddr(ctx, reverse+".")
+	if err != nil {
+		check.Status = ReverseStatusUnresolved
+		check.Error = err.Error()
+		// The server named in DNS errors is the system one, even with a custom resolver
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			check.Error = dnsErr.Err
+		}
+		return check
+	}
+
+	check.Status = ReverseStatusMismatch
+	for _, addr := range addrs {
+		check.Resolved = append(check.Resolved, addr.IP.String())
+		if addr.IP.Equal(expected) {
+			check.Status = ReverseStatusOK
+		}
+	}
+	return check
+}
+
+func (run *RunMiddleware) printReverseChecks(result ReverseCheckResult) {
+	if len(result.Checks) == 0 {
+		fmt.Println("No IP to check")
+		return
+	}
+
+	table := NewTable("IP", "SERVER", "REVERSE", "STATUS", "DETAIL")
+	table.SetNoColor(!run.Color)
+	for _, check := range result.Checks {
+		var statusColorFn func(string) string
+		if run.Color {
+			statusColorFn = ColorFn("red")
+			if check.Status == ReverseStatusOK {
+				statusColorFn = ColorFn("green")
+			}
+		}
+		detail := check.Error
+		switch check.Status {
+		case ReverseStatusMismatch:
+			detail = "resolves to " + strings.Join(check.Resolved, ", ")
+		case ReverseStatusDefault:
+			detail = "reverse not customized"
+		}
+		table.AddRow(
+			ColIP(check.IP),
+			ColName(check.ServerName),
+			Col(check.Reverse),
+			ColColor(check.Status, statusColorFn),
+			Col(detail),
+		)
+	}
+	table.Print()
+
+	if result.Problems > 0 {
+		fmt.Printf("%s %d/%d IP(s) without a forward-confirmed reverse (resolver: %s)\n",
+			run.Colorize("Error:", "red"), result.Problems, len(result.Checks), result.Resolver)
+	} else {
+		fmt.Printf("%s %d reverse(s) resolve back to their IP (resolver: %s)\n",
+			run.Colorize("Success:", "green"), len(result.Checks), result.Resolver)
+	}
+}
@@ -0,0 +1,82 @@
+package run
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	"titan-sc/api"
+)
+
+// fakeResolver answers lookups from a map of host names, with a "no such host"
+// DNS error for the others
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addresses, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: "127.0.0.53:53", IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, 0, len(addresses))
+	for _, address := range addresses {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(address)})
+	}
+	return addrs, nil
+}
+
+func TestCheckReverses(t *testing.T) {
+	resolver := fakeResolver{
+		"web-01.example.com.": {"203.0.113.10", "2001:db8::10"},
+		"web-02.example.com.": {"203.0.113.99"},
+	}
+	ips := []api.IP{
+		{Address: "203.0.113.12", ServerName: "db-01"},
+		{Address: "203.0.113.11", ServerName: "web-02", Reverse: "web-02.example.com"},
+		{Address: "2001:0db8:0:0::10", ServerName: "web-01", Reverse: "web-01.example.com."},
+		{Address: "203.0.113.10", ServerName: "web-01", Reverse: "web-01.example.com"},
+		{Address: "203.0.113.13", ServerName: "web-03", Reverse: "web-03.example.com"},
+		{Address: "203.0.113.14", ServerName: "web-04", Reverse: "ip-14.titan.example.", DefaultReverse: "ip-14.titan.example"},
+	}
+
+	want := []ReverseCheck{
+		{IP: "203.0.113.10", ServerName: "web-01", Reverse: "web-01.example.com", Status: ReverseStatusOK,
+			Resolved: []string{"203.0.113.10", "2001:db8::10"}},
+		{IP: "203.0.113.11", ServerName: "web-02", Reverse: "web-02.example.com", Status: ReverseStatusMismatch,
+			Resolved: []string{"203.0.113.99"}},
+		{IP: "203.0.113.12", ServerName: "db-01", Status: ReverseStatusNoReverse},
+		{IP: "203.0.113.13", ServerName: "web-03", Reverse: "web-03.example.com", Status: ReverseStatusUnresolved,
+			Error: "no such host"},
+		{IP: "203.0.113.14", ServerName: "web-04", Reverse: "ip-14.titan.example.", Status: ReverseStatusDefault},
+		{IP: "2001:db8::10", ServerName: "web-01", Reverse: "web-01.example.com.", Status: ReverseStatusOK,
+			Resolved: []string{"203.0.113.10", "2001:db8::10"}},
+	}
+	got := checkReverses(resolver, ips, time.Second)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("checkReverses() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestNewHostResolver(t *testing.T) {
+	tests := []struct {
+		address string
+		name    string
+	}{
+		{address: "", name: "system"},
+		{address: "1.1.1.1", name: "1.1.1.1:53"},
+		{address: "127.0.0.1:5353", name: "127.0.0.1:5353"},
+		{address: "2001:db8::53", name: "[2001:db8::53]:53"},
+		{address: "[2001:db8::53]:5353", name: "[2001:db8::53]:5353"},
+		{address: "dns.example.com", name: "dns.example.com:53"},
+	}
+	for _, test := range tests {
+		resolver, name, err := newHostResolver(test.address)
+		if err != nil {
+			t.Errorf("newHostResolver(%q) failed: %v", test.address, err)
+			continue
+		}
+		if resolver == nil || name != test.name {
+			t.Errorf("newHostResolver(%q) = %v, %q, want resolver named %q", test.address, resolver, name, test.name)
+		}
+	}
+}
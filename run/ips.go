@@ -1,11 +1,11 @@
 package run
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net"
 	"sort"
+	"strings"
 
 	"titan-sc/api"
 
@@ -18,8 +18,12 @@ func (run *RunMiddleware) IPAttach(cmd *cobra.Command, args []string) {
 	serverOID, _ := cmd.Flags().GetString("server-oid")
 	ip, _ := cmd.Flags().GetString("ip")
 
-	parsedIP := net.ParseIP(ip)
-	apiReturn, err := run.API.IPAttach(serverOID, []string{parsedIP.String()})
+	address, err := run.companyIPAddress(cmd, ip)
+	if err != nil {
+		run.OutputError(err)
+		return
+	}
+	apiReturn, err := run.API.IPAttach(serverOID, []string{address})
 	if err != nil {
 		run.OutputError(err)
 		return
@@ -29,9 +33,9 @@ func (run *RunMiddleware) IPAttach(cmd *cobra.Command, args []string) {
 		return
 	}
 	if run.JSONOutput {
-		printAsJson(map[string]string{"success": fmt.Sprintf("IP %s attached to server %s", parsedIP.String(), serverOID)})
+		printAsJson(map[string]string{"success": fmt.Sprintf("IP %s attached to server %s", normalizeIP(address), serverOID)})
 	} else {
-		fmt.Printf("%s IP %s attached to server %s\n", run.Colorize("Success:", "green"), parsedIP.String(), serverOID)
+		fmt.Printf("%s IP %s attached to server %s\n", run.Colorize("Success:", "green"), normalizeIP(address), serverOID)
 	}
 }
 
@@ -41,8 +45,12 @@ func (run *RunMiddleware) IPDetach(cmd *cobra.Command, args []string) {
 	serverOID, _ := cmd.Flags().GetString("server-oid")
 	ip, _ := cmd.Flags().GetString("ip")
 
-	parsedIP := net.ParseIP(ip)
-	apiReturn, err := run.API.IPDetach(serverOID, []string{parsedIP.String()})
+	address, err := run.companyIPAddress(cmd, ip)
+	if err != nil {
+		run.OutputError(err)
+		return
+	}
+	apiReturn, err := run.API.IPDetach(serverOID, []string{address})
 	if err != nil {
 		run.OutputError(err)
 		return
@@ -52,15 +60,42 @@ func (run *RunMiddleware) IPDetach(cmd *cobra.Command, args []string) {
 		return
 	}
 	if run.JSONOutput {
-		printAsJson(map[string]string{"success": fmt.Sprintf("IP %s detached from server %s", parsedIP.String(), serverOID)})
+		printAsJson(map[string]string{"success": fmt.Sprintf("IP %s detached from server %s", normalizeIP(address), serverOID)})
 	} else {
-		fmt.Printf("%s IP %s detached from server %s\n", run.Colorize("Success:", "green"), parsedIP.String(), serverOID)
+		fmt.Printf("%s IP %s detached from server %s\n", run.Colorize("Success:", "green"), normalizeIP(address), serverOID)
 	}
 }
 
+// IPUsageSummary counts the company IPs, returned as JSON by 'ip list --summary'
+type IPUsageSummary struct {
+	Total      int `json:"total"`
+	Attached   int `json:"attached"`
+	Unattached int `json:"unattached"`
+	IPv4       int `json:"ipv4"`
+	IPv6       int `json:"ipv6"`
+}
+
+// ServerIPs groups the IPs attached to a server, returned as JSON by 'ip list --by-server'
+type ServerIPs struct {
+	ServerOID  string   `json:"server_oid"`
+	ServerName string   `json:"server_name"`
+	IPs        []api.IP `json:"ips"`
+}
+
 func (run *RunMiddleware) IPsCompanyList(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
+	attached, _ := cmd.Flags().GetBool("attached")
+	unattached, _ := cmd.Flags().GetBool("unattached")
+	server, _ := cmd.Flags().GetString("server")
+	version, _ := cmd.Flags().GetInt("version")
+	byServer, _ := cmd.Flags().GetBool("by-server")
+	summary, _ := cmd.Flags().GetBool("summary")
+
+	if version != 0 && version != 4 && version != 6 {
+		run.OutputError(fmt.Errorf("invalid IP version %d: must be 4 or 6", version))
+		return
+	}
 
 	companyOID, err := run.ResolveCompanyOID(cmd)
 	if err != nil {
@@ -73,11 +108,47 @@ func (run *RunMiddleware) IPsCompanyList(cmd *cobra.Command, args []string) {
 		run.OutputError(err)
 		return
 	}
-	if run.JSONOutput {
-		printAsJson(ipList)
-	} else {
-		run.IPsPrint(ipList)
+
+	filtered := make([]api.IP, 0, len(ipList))
+	for _, ip := range ipList {
+		ip.Address = normalizeIP(ip.Address)
+		switch {
+		case attached && ip.ServerOID == "",
+			unattached && ip.ServerOID != "",
+			server != "" && ip.ServerOID != server && !strings.EqualFold(ip.ServerName, server),
+			version != 0 && ipVersion(ip.Address) != version:
+			continue
+		}
+		filtered = append(filtered, ip)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return compareIPs(filtered[i].Address, filtered[j].Address) < 0
+	})
+
+	switch {
+	case summary:
+		run.printIPUsageSummary(summarizeIPs(filtered))
+	case byServer:
+		run.printIPsByServer(groupIPsByServer(filtered))
+	case run.JSONOutput:
+		printAsJson(filtered)
+	default:
+		run.IPsPrint(filtered)
+	}
+}
+
+// IPReverse runs 'ip reverse --ip IP --reverse REVERSE', the deprecated form of
+// 'ip reverse set'. Without these flags, it shows the help of the subcommands.
+func (run *RunMiddleware) IPReverse(cmd *cobra.Command, args []string) {
+	run.ParseGlobalFlags(cmd)
+	if !cmd.Flags().Changed("ip") && !cmd.Flags().Changed("reverse") {
+		_ = cmd.Help()
+		return
+	}
+	if !cmd.Flags().Changed("ip") || !cmd.Flags().Changed("reverse") {
+		run.OutputErrorAndExit(errors.New("--ip and --reverse are required, use 'ip reverse set --ip IP --reverse REVERSE'"))
 	}
+	run.IPUpdateReverse(cmd, args)
 }
 
 func (run *RunMiddleware) IPUpdateReverse(cmd *cobra.Command, args []string) {
@@ -86,41 +157,181 @@ func (run *RunMiddleware) IPUpdateReverse(cmd *cobra.Command, args []string) {
 	argIP, _ := cmd.Flags().GetString("ip")
 	newIPReverse, _ := cmd.Flags().GetString("reverse")
 
-	user, err := run.API.GetUserInfos()
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
 	if err != nil {
 		run.OutputError(err)
 		return
 	}
 
-	ips, err := run.API.GetCompanyIPList(user.DefaultCompanyOID)
+	ips, err := run.API.GetCompanyIPList(companyOID)
 	if err != nil {
 		run.OutputError(err)
 		return
 	}
 
-	for _, ip := range ips {
-		if ip.Address == argIP {
-			apiReturn, err := run.API.IPUpdateReverse(ip.OID, newIPReverse)
-			if err != nil {
-				run.OutputError(err)
-				return
-			}
-			if apiReturn != nil {
-				run.printAPIReturn(apiReturn)
-				return
-			}
-			if run.JSONOutput {
-				printAsJson(map[string]string{"success": fmt.Sprintf("Reverse DNS for %s updated to %s", argIP, newIPReverse)})
-			} else {
-				fmt.Printf("%s Reverse DNS for %s updated to %s\n", run.Colorize("Success:", "green"), argIP, newIPReverse)
-			}
+	if ip := findCompanyIP(ips, argIP); ip != nil {
+		apiReturn, err := run.API.IPUpdateReverse(ip.OID, newIPReverse)
+		if err != nil {
+			run.OutputError(err)
+			return
+		}
+		if apiReturn != nil {
+			run.printAPIReturn(apiReturn)
 			return
 		}
+		if run.JSONOutput {
+			printAsJson(map[string]string{"success": fmt.Sprintf("Reverse DNS for %s updated to %s", normalizeIP(ip.Address), newIPReverse)})
+		} else {
+			fmt.Printf("%s Reverse DNS for %s updated to %s\n", run.Colorize("Success:", "green"), normalizeIP(ip.Address), newIPReverse)
+		}
+		return
 	}
 
 	run.OutputError(errors.New("IP not found"))
 }
 
+// companyIPAddress validates address and returns it as known by the company (default
+// company unless --company-oid), so that any IPv6 notation matches. Addresses not found
+// in the company are returned normalized.
+func (run *RunMiddleware) companyIPAddress(cmd *cobra.Command, address string) (string, error) {
+	parsed := net.ParseIP(strings.TrimSpace(address))
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address '%s'", address)
+	}
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		return "", err
+	}
+	ips, err := run.API.GetCompanyIPList(companyOID)
+	if err != nil {
+		return "", err
+	}
+	if ip := findCompanyIP(ips, address); ip != nil {
+		return ip.Address, nil
+	}
+	return parsed.String(), nil
+}
+
+// normalizeIP returns the canonical form of an IP address (compressed IPv6),
+// or address unchanged if it is not valid
+func normalizeIP(address string) string {
+	if parsed := net.ParseIP(address); parsed != nil {
+		return parsed.String()
+	}
+	return address
+}
+
+// ipVersion returns 4 or 6, or 0 for an invalid address
+func ipVersion(address string) int {
+	parsed := net.ParseIP(address)
+	switch {
+	case parsed == nil:
+		return 0
+	case parsed.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
+func summarizeIPs(ips []api.IP) IPUsageSummary {
+	summary := IPUsageSummary{Total: len(ips)}
+	for _, ip := range ips {
+		if ip.ServerOID != "" {
+			summary.Attached++
+		} else {
+			summary.Unattached++
+		}
+		if ipVersion(ip.Address) == 6 {
+			summary.IPv6++
+		} else {
+			summary.IPv4++
+		}
+	}
+	return summary
+}
+
+// groupIPsByServer groups IPs by server, sorted by server name, unattached IPs last
+func groupIPsByServer(ips []api.IP) []ServerIPs {
+	var groups []ServerIPs
+	index := map[string]int{}
+	for _, ip := range ips {
+		i, ok := index[ip.ServerOID]
+		if !ok {
+			i = len(groups)
+			index[ip.ServerOID] = i
+			groups = append(groups, ServerIPs{ServerOID: ip.ServerOID, ServerName: ip.ServerName})
+		}
+		groups[i].IPs = append(groups[i].IPs, ip)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].ServerOID == "") != (groups[j].ServerOID == "") {
+			return groups[j].ServerOID == ""
+		}
+		return groups[i].ServerName < groups[j].ServerName
+	})
+	return groups
+}
+
+func (run *RunMiddleware) printIPUsageSummary(summary IPUsageSummary) {
+	if run.JSONOutput {
+		printAsJson(summary)
+		return
+	}
+	w := NewTable("TOTAL", "ATTACHED", "UNATTACHED", "IPV4", "IPV6")
+	w.AddRow(
+		ColCount(fmt.Sprint(summary.Total)),
+		ColCount(fmt.Sprint(summary.Attached)),
+		ColCount(fmt.Sprint(summary.Unattached)),
+		ColCount(fmt.Sprint(summary.IPv4)),
+		ColCount(fmt.Sprint(summary.IPv6)),
+	)
+	w.Print()
+}
+
+func (run *RunMiddleware) printIPsByServer(groups []ServerIPs) {
+	if run.JSONOutput {
+		if groups == nil {
+			groups = []ServerIPs{}
+		}
+		printAsJson(groups)
+		return
+	}
+	if len(groups) == 0 {
+		fmt.Println("Empty IPs list")
+		return
+	}
+
+	w := NewTable("SERVER", "SERVER OID", "IP", "REVERSE")
+	for _, group := range groups {
+		serverName := group.ServerName
+		var serverColorFn func(string) string
+		if run.Color {
+			serverColorFn = ColorFn("cyan")
+		}
+		if group.ServerOID == "" {
+			serverName = "(unassigned)"
+			if run.Color {
+				serverColorFn = ColorFn("dim")
+			}
+		}
+		for i, ip := range group.IPs {
+			// The server is only named on the first row of its group
+			name, oid := serverName, group.ServerOID
+			if i > 0 {
+				name, oid = "", ""
+			}
+			w.AddRow(
+				ColColor(name, serverColorFn),
+				ColOID(oid),
+				ColIP(ip.Address),
+				Col(ip.Reverse),
+			)
+		}
+	}
+	w.Print()
+}
+
 func (run *RunMiddleware) IPsPrint(ipArray []api.IP) {
 	if len(ipArray) == 0 {
 		fmt.Println("Empty IPs list")
@@ -129,18 +340,7 @@ func (run *RunMiddleware) IPsPrint(ipArray []api.IP) {
 
 	// Sort IPs: IPv4 first (sorted), then IPv6 (sorted)
 	sort.Slice(ipArray, func(i, j int) bool {
-		ipI := net.ParseIP(ipArray[i].Address)
-		ipJ := net.ParseIP(ipArray[j].Address)
-
-		// IPv4 before IPv6
-		isIPv4i := ipI.To4() != nil
-		isIPv4j := ipJ.To4() != nil
-		if isIPv4i != isIPv4j {
-			return isIPv4i // IPv4 comes first
-		}
-
-		// Same version, sort by IP bytes
-		return bytes.Compare(ipI, ipJ) < 0
+		return compareIPs(ipArray[i].Address, ipArray[j].Address) < 0
 	})
 
 	w := NewTable("IP", "REVERSE", "SERVER")
@@ -0,0 +1,146 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"titan-sc/api"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ManifestVersion is the version of the manifest format
+const ManifestVersion = 1
+
+// Manifest describes the infrastructure of a company: servers, private networks,
+// IP attachments and reverses, SSH keys and network DRP. It is read by 'plan' and
+// 'apply', in YAML or JSON.
+type Manifest struct {
+	Version    int               `json:"version" yaml:"version"`
+	CompanyOID string            `json:"company_oid,omitempty" yaml:"company_oid,omitempty"`
+	SSHKeys    []ManifestSSHKey  `json:"ssh_keys,omitempty" yaml:"ssh_keys,omitempty"`
+	Networks   []ManifestNetwork `json:"networks,omitempty" yaml:"networks,omitempty"`
+	Servers    []ManifestServer  `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
+// ManifestSSHKey is an SSH key of the user
+type ManifestSSHKey struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// ManifestNetwork is a private network. Servers lists the names of all the servers
+// attached to it, or their OID when several servers share a name: servers attached
+// but not listed are detached. Drp enables or disables DRP replication, and leaves
+// it unchanged when not set.
+type ManifestNetwork struct {
+	OID     string   `json:"oid,omitempty" yaml:"oid,omitempty"`
+	Name    string   `json:"name" yaml:"name"`
+	Drp     *bool    `json:"drp,omitempty" yaml:"drp,omitempty"`
+	Servers []string `json:"servers" yaml:"servers"`
+}
+
+// ManifestServer is a server. Without OID, it is matched by name, and ordered if it
+// does not exist. SSHKeys names the keys installed when the server is ordered.
+// Drp records whether DRP replication is enabled; apply only reports a difference.
+type ManifestServer struct {
+	OID         string       `json:"oid,omitempty" yaml:"oid,omitempty"`
+	Name        string       `json:"name" yaml:"name"`
+	Plan        string       `json:"plan" yaml:"plan"`
+	TemplateOID string       `json:"template_oid,omitempty" yaml:"template_oid,omitempty"`
+	OS          string       `json:"os,omitempty" yaml:"os,omitempty"`
+	OSVersion   string       `json:"os_version,omitempty" yaml:"os_version,omitempty"`
+	CPU         int          `json:"cpu,omitempty" yaml:"cpu,omitempty"`   // Cores
+	RAM         int          `json:"ram,omitempty" yaml:"ram,omitempty"`   // GB
+	Disk        int          `json:"disk,omitempty" yaml:"disk,omitempty"` // GB
+	SSHKeys     []string     `json:"ssh_keys,omitempty" yaml:"ssh_keys,omitempty"`
+	Drp         *bool        `json:"drp,omitempty" yaml:"drp,omitempty"`
+	IPs         []ManifestIP `json:"ips,omitempty" yaml:"ips,omitempty"`
+}
+
+// ManifestIP is an IP attached to a server, with its reverse when managed
+type ManifestIP struct {
+	Address string `json:"address" yaml:"address"`
+	Reverse string `json:"reverse,omitempty" yaml:"reverse,omitempty"`
+}
+
+// loadManifest reads a YAML or JSON manifest ("-" for stdin). Unknown fields are
+// rejected so that typos do not silently change the meaning of the manifest.
+func loadManifest(path string) (*Manifest, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if manifest.Version == 0 {
+		manifest.Version = ManifestVersion
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("%s: unsupported manifest version %d (expected %d)", path, manifest.Version, ManifestVersion)
+	}
+	return manifest, nil
+}
+
+// liveState is the current state of the resources a manifest describes
+type liveState struct {
+	CompanyOID string
+	Servers    []api.ServerDetail
+	Networks   []api.NetworkDetail
+	IPs        []api.IP
+	SSHKeys    []api.SSHKey
+}
+
+// loadLiveState fetches the servers, networks and IPs of a company and the SSH keys of the user
+func (run *RunMiddleware) loadLiveState(companyOID string) (*liveState, error) {
+	state := &liveState{CompanyOID: companyOID}
+
+	servers, apiReturn, err := run.API.ServerList(companyOID)
+	if err = apiCallError(apiReturn, err); err != nil {
+		return nil, err
+	}
+	if err = run.completeServerDetails(servers); err != nil {
+		return nil, err
+	}
+	state.Servers = servers
+
+	networks, err := run.API.GetNetworkList(companyOID)
+	if err != nil {
+		return nil, err
+	}
+	state.Networks = networks.Networks
+
+	if state.IPs, err = run.API.GetCompanyIPList(companyOID); err != nil {
+		return nil, err
+	}
+
+	user, err := run.API.GetUserInfos()
+	if err != nil {
+		return nil, err
+	}
+	if state.SSHKeys, err = run.API.GetSSHKeyList(user.OID); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// serverResources returns the CPU cores, RAM (GB) and disk (GB) of a server
+func serverResources(server *api.ServerDetail) (cpu, ram, disk int) {
+	cpu = int(server.Items.CPU.ItemUnit.Value) * int(server.Items.CPU.Quantity)
+	ram = int(server.Items.RAM.ItemUnit.Value) * int(server.Items.RAM.Quantity)
+	disk = int(server.Items.DISK.ItemUnit.Value) * int(server.Items.DISK.Quantity)
+	return cpu, ram, disk
+}
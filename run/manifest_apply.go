@@ -0,0 +1,250 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// errManifestNoFile is returned when no manifest file is given
+var errManifestNoFile = errors.New("manifest file is required: use --file FILE, or --file - for stdin")
+
+// manifestApplier holds the state shared by the changes of a plan while they are applied
+type manifestApplier struct {
+	run        *RunMiddleware
+	companyOID string
+	timeout    time.Duration
+	order      *serverOrder
+
+	// Manifest names to OIDs, completed as servers and networks are created
+	serverOIDs  map[string]string
+	networkOIDs map[string]string
+}
+
+// serverOID returns the OID of a server of the manifest or of a live server, given
+// by name or OID
+func (a *manifestApplier) serverOID(name string) (string, error) {
+	if oid := a.serverOIDs[name]; oid != "" {
+		return oid, nil
+	}
+	servers, apiReturn, err := a.run.API.ServerList(a.companyOID)
+	if err = apiCallError(apiReturn, err); err != nil {
+		return "", err
+	}
+	for _, server := range servers {
+		if server.OID == name {
+			return server.OID, nil
+		}
+	}
+	for _, server := range servers {
+		if server.Name == name {
+			return server.OID, nil
+		}
+	}
+	return "", fmt.Errorf("server '%s' not found", name)
+}
+
+// ManifestPlanCmd prints the changes 'apply' would make for a manifest
+func (run *RunMiddleware) ManifestPlanCmd(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+
+	plan, _, err := run.prepareManifestPlan(cmd, false)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(plan)
+		return
+	}
+	run.printManifestPlan(plan)
+}
+
+// ManifestApply makes the live state match a manifest: it computes the plan, asks
+// for confirmation and runs the changes in order, stopping at the first failure.
+// Ordering servers requires --confirm-payment.
+func (run *RunMiddleware) ManifestApply(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	confirmPayment, _ := cmd.Flags().GetBool("confirm-payment")
+	drpDisableConfirmed, _ := cmd.Flags().GetBool("yes-i-understand-network-will-be-unavailable")
+
+	plan, applier, err := run.prepareManifestPlan(cmd, true)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	pending := len(plan.Changes) - plan.Unsupported
+	if pending == 0 {
+		if run.JSONOutput {
+			printAsJson(plan)
+		} else {
+			run.printManifestPlan(plan)
+		}
+		return
+	}
+
+	if plan.Purchases > 0 && !confirmPayment {
+		run.OutputErrorAndExit(fmt.Errorf("the plan orders %d server(s): add --confirm-payment to proceed", plan.Purchases))
+	}
+	for _, change := range plan.Changes {
+		if change.Resource == "network_drp" && change.Action == ManifestActionDisable && !drpDisableConfirmed {
+			run.OutputErrorAndExit(fmt.Errorf("the plan disables DRP on network %s: add --yes-i-understand-network-will-be-unavailable to proceed", change.Name))
+		}
+	}
+
+	if !run.JSONOutput {
+		run.printManifestPlan(plan)
+	}
+	if err = run.confirmAction(cmd, fmt.Sprintf("Apply %d change(s) to company %s?", pending, plan.CompanyOID)); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	if plan.Purchases > 0 {
+		if applier.order.paymentMethodOID == "" {
+			if applier.order.paymentMethodOID, err = run.defaultPaymentMethod(plan.CompanyOID); err != nil {
+				run.OutputErrorAndExit(err)
+			}
+		}
+		var infos []*CreateServerInfo
+		for _, change := range plan.Changes {
+			if change.order != nil {
+				infos = append(infos, change.order)
+			}
+		}
+		if err = applier.order.checkBudget(infos); err != nil {
+			run.OutputErrorAndExit(err)
+		}
+	}
+
+	var failed error
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if change.apply == nil {
+			continue
+		}
+		if !run.JSONOutput {
+			symbol, color := manifestActionStyle(change.Action)
+			fmt.Printf("%s %s %s %s...\n", run.Colorize(symbol, color), change.Action, change.Resource, change.Name)
+		}
+		if failed = change.apply(applier); failed != nil {
+			change.Error = failed.Error()
+			break
+		}
+		change.Applied = true
+	}
+
+	if run.JSONOutput {
+		printAsJson(plan)
+	} else if failed != nil {
+		run.OutputError(fmt.Errorf("apply stopped: %w", failed))
+	} else {
+		fmt.Printf("%s %d change(s) applied\n", run.Colorize("Success:", "green"), pending)
+	}
+	if failed != nil {
+		os.Exit(1)
+	}
+}
+
+// prepareManifestPlan loads the manifest given by --file and plans it against the
+// live state of the company (--company-oid, then the manifest company_oid, then the default company).
+// With apply, the applier is set up with the order flags of 'apply'.
+func (run *RunMiddleware) prepareManifestPlan(cmd *cobra.Command, apply bool) (*ManifestPlan, *manifestApplier, error) {
+	path, _ := cmd.Flags().GetString("file")
+	if path == "" {
+		return nil, nil, errManifestNoFile
+	}
+	manifest, err := loadManifest(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	companyOID, _ := cmd.Flags().GetString("company-oid")
+	if companyOID == "" {
+		companyOID = manifest.CompanyOID
+	}
+	if companyOID == "" {
+		if companyOID, err = run.GetDefaultCompanyOID(cmd); err != nil {
+			return nil, nil, err
+		}
+	}
+	if manifest.CompanyOID != "" && manifest.CompanyOID != companyOID {
+		return nil, nil, fmt.Errorf("manifest describes company %s, not %s", manifest.CompanyOID, companyOID)
+	}
+
+	live, err := run.loadLiveState(companyOID)
+	if err != nil {
+		return nil, nil, err
+	}
+	plan, serverOIDs, networkOIDs, err := run.planManifest(manifest, live)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applier := &manifestApplier{
+		run:         run,
+		companyOID:  companyOID,
+		serverOIDs:  serverOIDs,
+		networkOIDs: networkOIDs,
+	}
+	applier.order = &serverOrder{run: run, command: cmd.CommandPath(), companyOID: companyOID}
+	if apply {
+		applier.order.overrideBudget, _ = cmd.Flags().GetBool("override-budget")
+		applier.timeout, _ = cmd.Flags().GetDuration("timeout")
+		applier.order.paymentMethodOID, _ = cmd.Flags().GetString("payment-method")
+		applier.order.subscriptionOID, _ = cmd.Flags().GetString("subscription-oid")
+	}
+	if applier.timeout <= 0 {
+		applier.timeout = DefaultProvisionTimeout
+	}
+	applier.order.timeout = applier.timeout
+	return plan, applier, nil
+}
+
+// manifestActionStyle returns the symbol and color of a change action
+func manifestActionStyle(action string) (string, string) {
+	switch action {
+	case ManifestActionCreate, ManifestActionAttach, ManifestActionEnable:
+		return "+", "green"
+	case ManifestActionDetach, ManifestActionDisable:
+		return "-", "red"
+	case ManifestActionUnsupported:
+		return "!", "yellow"
+	default:
+		return "~", "yellow"
+	}
+}
+
+func (run *RunMiddleware) printManifestPlan(plan *ManifestPlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Printf("No changes: company %s matches the manifest\n", plan.CompanyOID)
+		return
+	}
+
+	table := NewTable("", "ACTION", "RESOURCE", "NAME", "DETAIL")
+	table.SetNoColor(!run.Color)
+	for _, change := range plan.Changes {
+		symbol, color := manifestActionStyle(change.Action)
+		var colorFn func(string) string
+		if run.Color {
+			colorFn = ColorFn(color)
+		}
+		table.AddRow(
+			ColColor(symbol, colorFn),
+			Col(change.Action),
+			Col(change.Resource),
+			ColName(change.Name),
+			Col(change.Detail),
+		)
+	}
+	table.Print()
+
+	pending := len(plan.Changes) - plan.Unsupported
+	fmt.Printf("Plan: %d change(s), %d server order(s)", pending, plan.Purchases)
+	if plan.Unsupported > 0 {
+		fmt.Printf(", %d difference(s) apply cannot fix", plan.Unsupported)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,287 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// DriftExitCode is the exit status of 'drift check' when anything drifted, errors
+// exit with status 1
+const DriftExitCode = 2
+
+// Drift changes
+const (
+	DriftAdded   = "added"
+	DriftRemoved = "removed"
+	DriftChanged = "changed"
+)
+
+// Drift is a difference between a baseline manifest and the live state
+type Drift struct {
+	Resource string `json:"resource"` // server, network, ip, ssh_key
+	Name     string `json:"name"`
+	OID      string `json:"oid,omitempty"`
+	Change   string `json:"change"`
+	Field    string `json:"field,omitempty"`
+	Baseline string `json:"baseline,omitempty"`
+	Current  string `json:"current,omitempty"`
+}
+
+// DriftReport is returned as JSON by 'drift check'
+type DriftReport struct {
+	CompanyOID string  `json:"company_oid"`
+	Baseline   string  `json:"baseline"`
+	Drifts     []Drift `json:"drifts"`
+}
+
+// DriftCheck compares the live state of a company with a baseline exported by
+// 'export'. Exits with DriftExitCode if anything drifted, 1 on errors.
+func (run *RunMiddleware) DriftCheck(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	path, _ := cmd.Flags().GetString("baseline")
+
+	baseline, err := loadManifest(path)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	companyOID, _ := cmd.Flags().GetString("company-oid")
+	if companyOID == "" {
+		companyOID = baseline.CompanyOID
+	}
+	if companyOID == "" {
+		if companyOID, err = run.GetDefaultCompanyOID(cmd); err != nil {
+			run.OutputErrorAndExit(err)
+		}
+	}
+	live, err := run.loadLiveState(companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	report := DriftReport{
+		CompanyOID: companyOID,
+		Baseline:   path,
+		Drifts:     diffManifests(baseline, exportManifest(live)),
+	}
+	if run.JSONOutput {
+		printAsJson(report)
+	} else {
+		run.printDriftReport(report)
+	}
+	if len(report.Drifts) > 0 {
+		os.Exit(DriftExitCode)
+	}
+}
+
+// diffManifests lists the differences between a baseline and the current state,
+// by resource: servers, networks, IPs, SSH keys
+func diffManifests(baseline, current *Manifest) []Drift {
+	var drifts []Drift
+	drifts = append(drifts, diffServers(baseline.Servers, current.Servers)...)
+	drifts = append(drifts, diffNetworks(baseline.Networks, current.Networks)...)
+	drifts = append(drifts, diffIPs(baseline.Servers, current.Servers)...)
+	drifts = append(drifts, diffSSHKeys(baseline.SSHKeys, current.SSHKeys)...)
+	return drifts
+}
+
+// driftField appends a changed field drift when the baseline value is set and differs
+func driftField(drifts []Drift, resource, name, oid, field, baseline, current string) []Drift {
+	if baseline == "" || baseline == current {
+		return drifts
+	}
+	return append(drifts, Drift{Resource: resource, Name: name, OID: oid, Change: DriftChanged, Field: field, Baseline: baseline, Current: current})
+}
+
+func diffServers(baseline, current []ManifestServer) []Drift {
+	var drifts []Drift
+	matched := map[string]bool{}
+	for _, before := range baseline {
+		after := findManifestServer(current, &before)
+		if after == nil {
+			drifts = append(drifts, Drift{Resource: "server", Name: before.Name, OID: before.OID, Change: DriftRemoved})
+			continue
+		}
+		matched[after.OID] = true
+		name, oid := after.Name, after.OID
+		drifts = driftField(drifts, "server", name, oid, "name", before.Name, after.Name)
+		drifts = driftField(drifts, "server", name, oid, "plan", strings.ToUpper(before.Plan), strings.ToUpper(after.Plan))
+		drifts = driftField(drifts, "server", name, oid, "cpu", driftInt(before.CPU), strconv.Itoa(after.CPU))
+		drifts = driftField(drifts, "server", name, oid, "ram", driftInt(before.RAM), strconv.Itoa(after.RAM))
+		drifts = driftField(drifts, "server", name, oid, "disk", driftInt(before.Disk), strconv.Itoa(after.Disk))
+		drifts = driftField(drifts, "server", name, oid, "template_oid", before.TemplateOID, after.TemplateOID)
+		if before.Drp != nil && after.Drp != nil {
+			drifts = driftField(drifts, "server", name, oid, "drp", enabledLabel(*before.Drp), enabledLabel(*after.Drp))
+		}
+	}
+	for _, after := range current {
+		if !matched[after.OID] {
+			drifts = append(drifts, Drift{Resource: "server", Name: after.Name, OID: after.OID, Change: DriftAdded})
+		}
+	}
+	return drifts
+}
+
+// findManifestServer finds a server by OID, or by name when the baseline has no OID
+func findManifestServer(servers []ManifestServer, server *ManifestServer) *ManifestServer {
+	for i := range servers {
+		if (server.OID != "" && servers[i].OID == server.OID) || (server.OID == "" && servers[i].Name == server.Name) {
+			return &servers[i]
+		}
+	}
+	return nil
+}
+
+func driftInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+func diffNetworks(baseline, current []ManifestNetwork) []Drift {
+	var drifts []Drift
+	matched := map[string]bool{}
+	for _, before := range baseline {
+		var after *ManifestNetwork
+		for i := range current {
+			if (before.OID != "" && current[i].OID == before.OID) || (before.OID == "" && current[i].Name == before.Name) {
+				after = &current[i]
+				break
+			}
+		}
+		if after == nil {
+			drifts = append(drifts, Drift{Resource: "network", Name: before.Name, OID: before.OID, Change: DriftRemoved})
+			continue
+		}
+		matched[after.OID] = true
+		name, oid := after.Name, after.OID
+		drifts = driftField(drifts, "network", name, oid, "name", before.Name, after.Name)
+		if before.Drp != nil && after.Drp != nil {
+			drifts = driftField(drifts, "network", name, oid, "drp", enabledLabel(*before.Drp), enabledLabel(*after.Drp))
+		}
+		drifts = driftField(drifts, "network", name, oid, "servers", driftList(before.Servers), driftList(after.Servers))
+	}
+	for _, after := range current {
+		if !matched[after.OID] {
+			drifts = append(drifts, Drift{Resource: "network", Name: after.Name, OID: after.OID, Change: DriftAdded})
+		}
+	}
+	return drifts
+}
+
+// driftList returns a sorted, comma-separated list, "-" when empty
+func driftList(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// manifestIPOwner is the server an IP is attached to in a manifest, and its reverse
+type manifestIPOwner struct {
+	server, reverse string
+}
+
+func manifestIPOwners(servers []ManifestServer) map[string]manifestIPOwner {
+	owners := map[string]manifestIPOwner{}
+	for _, server := range servers {
+		for _, ip := range server.IPs {
+			owners[normalizeIP(ip.Address)] = manifestIPOwner{server: server.Name, reverse: strings.TrimSuffix(ip.Reverse, ".")}
+		}
+	}
+	return owners
+}
+
+func diffIPs(baseline, current []ManifestServer) []Drift {
+	before, after := manifestIPOwners(baseline), manifestIPOwners(current)
+	addresses := make([]string, 0, len(before)+len(after))
+	for address := range before {
+		addresses = append(addresses, address)
+	}
+	for address := range after {
+		if _, ok := before[address]; !ok {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return compareIPs(addresses[i], addresses[j]) < 0
+	})
+
+	var drifts []Drift
+	for _, address := range addresses {
+		b, inBaseline := before[address]
+		a, attached := after[address]
+		switch {
+		case !inBaseline:
+			drifts = append(drifts, Drift{Resource: "ip", Name: address, Change: DriftAdded, Field: "server", Current: a.server})
+		case !attached:
+			drifts = append(drifts, Drift{Resource: "ip", Name: address, Change: DriftRemoved, Field: "server", Baseline: b.server})
+		default:
+			drifts = driftField(drifts, "ip", address, "", "server", b.server, a.server)
+			if !sameHostname(b.reverse, a.reverse) {
+				drifts = append(drifts, Drift{Resource: "ip", Name: address, Change: DriftChanged, Field: "reverse", Baseline: b.reverse, Current: a.reverse})
+			}
+		}
+	}
+	return drifts
+}
+
+func diffSSHKeys(baseline, current []ManifestSSHKey) []Drift {
+	var drifts []Drift
+	values := map[string]string{}
+	for _, key := range current {
+		values[key.Name] = key.Value
+	}
+	seen := map[string]bool{}
+	for _, key := range baseline {
+		seen[key.Name] = true
+		value, ok := values[key.Name]
+		switch {
+		case !ok:
+			drifts = append(drifts, Drift{Resource: "ssh_key", Name: key.Name, Change: DriftRemoved})
+		case !sameSSHKey(key.Value, value):
+			drifts = append(drifts, Drift{Resource: "ssh_key", Name: key.Name, Change: DriftChanged, Field: "value"})
+		}
+	}
+	for _, key := range current {
+		if !seen[key.Name] {
+			drifts = append(drifts, Drift{Resource: "ssh_key", Name: key.Name, Change: DriftAdded})
+		}
+	}
+	return drifts
+}
+
+func (run *RunMiddleware) printDriftReport(report DriftReport) {
+	if len(report.Drifts) == 0 {
+		fmt.Printf("%s company %s matches %s\n", run.Colorize("No drift:", "green"), report.CompanyOID, report.Baseline)
+		return
+	}
+
+	table := NewTable("RESOURCE", "NAME", "CHANGE", "FIELD", "BASELINE", "CURRENT")
+	table.SetNoColor(!run.Color)
+	for _, drift := range report.Drifts {
+		var changeColorFn func(string) string
+		if run.Color {
+			changeColorFn = ColorFn(map[string]string{DriftAdded: "green", DriftRemoved: "red", DriftChanged: "yellow"}[drift.Change])
+		}
+		table.AddRow(
+			Col(drift.Resource),
+			ColName(drift.Name),
+			ColColor(drift.Change, changeColorFn),
+			Col(drift.Field),
+			Col(drift.Baseline),
+			Col(drift.Current),
+		)
+	}
+	table.Print()
+	fmt.Printf("%s %d difference(s) between company %s and %s\n",
+		run.Colorize("Drift:", "red"), len(report.Drifts), report.CompanyOID, report.Baseline)
+}
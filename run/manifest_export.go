@@ -0,0 +1,152 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// Manifest export formats
+const (
+	ManifestFormatYAML = "yaml"
+	ManifestFormatJSON = "json"
+)
+
+// ManifestExport prints the live state of a company as a manifest, in a canonical
+// order so that two exports can be diffed and the result fed back to 'plan' and 'apply'
+func (run *RunMiddleware) ManifestExport(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	format, _ := cmd.Flags().GetString("format")
+	if run.JSONOutput {
+		format = ManifestFormatJSON
+	}
+	if format != ManifestFormatYAML && format != ManifestFormatJSON {
+		run.OutputErrorAndExit(fmt.Errorf("invalid format '%s': use %s or %s", format, ManifestFormatYAML, ManifestFormatJSON))
+	}
+
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	live, err := run.loadLiveState(companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	manifest := exportManifest(live)
+
+	if format == ManifestFormatJSON {
+		printAsJson(manifest)
+		return
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(manifest); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	_ = encoder.Close()
+}
+
+// exportManifest converts a live state into a manifest. Servers, networks and SSH
+// keys are sorted by name, IPs by address; resources keep their OID so that apply
+// matches them even after a rename.
+func exportManifest(live *liveState) *Manifest {
+	manifest := &Manifest{
+		Version:    ManifestVersion,
+		CompanyOID: live.CompanyOID,
+		SSHKeys:    []ManifestSSHKey{},
+		Networks:   []ManifestNetwork{},
+		Servers:    []ManifestServer{},
+	}
+
+	for _, key := range live.SSHKeys {
+		manifest.SSHKeys = append(manifest.SSHKeys, ManifestSSHKey{Name: key.Name, Value: strings.TrimSpace(key.Value)})
+	}
+	sort.SliceStable(manifest.SSHKeys, func(i, j int) bool {
+		return manifest.SSHKeys[i].Name < manifest.SSHKeys[j].Name
+	})
+
+	serverNames := make(map[string]string, len(live.Servers))
+	nameCount := map[string]int{}
+	for i := range live.Servers {
+		server := &live.Servers[i]
+		serverNames[server.OID] = server.Name
+		nameCount[server.Name]++
+		manifest.Servers = append(manifest.Servers, exportServer(server, live.IPs))
+	}
+	sort.SliceStable(manifest.Servers, func(i, j int) bool {
+		a, b := manifest.Servers[i], manifest.Servers[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.OID < b.OID
+	})
+
+	for _, network := range live.Networks {
+		drp := network.Drp != nil && network.Drp.Enabled
+		exported := ManifestNetwork{
+			OID:     network.OID,
+			Name:    network.Name,
+			Drp:     &drp,
+			Servers: []string{},
+		}
+		for _, iface := range network.Interfaces {
+			// Servers are named, unless several servers share the name
+			name, ok := serverNames[iface.Server.OID]
+			if !ok {
+				name = iface.Server.Name
+			} else if nameCount[name] > 1 {
+				name = iface.Server.OID
+			}
+			exported.Servers = append(exported.Servers, name)
+		}
+		sort.Strings(exported.Servers)
+		manifest.Networks = append(manifest.Networks, exported)
+	}
+	sort.SliceStable(manifest.Networks, func(i, j int) bool {
+		a, b := manifest.Networks[i], manifest.Networks[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.OID < b.OID
+	})
+	return manifest
+}
+
+func exportServer(server *api.ServerDetail, companyIPs []api.IP) ManifestServer {
+	cpu, ram, disk := serverResources(server)
+	drp := server.Drp != nil && server.Drp.Enabled
+	exported := ManifestServer{
+		OID:  server.OID,
+		Name: server.Name,
+		Plan: server.Items.CPU.Plan,
+		CPU:  cpu,
+		RAM:  ram,
+		Disk: disk,
+		Drp:  &drp,
+	}
+	if template := server.Items.OS.Template; template != nil {
+		exported.TemplateOID = template.OID
+		exported.OS = template.OS
+		exported.OSVersion = template.Version
+	}
+
+	for _, ip := range companyIPs {
+		if ip.ServerOID != server.OID {
+			continue
+		}
+		exported.IPs = append(exported.IPs, ManifestIP{
+			Address: normalizeIP(ip.Address),
+			Reverse: strings.TrimSuffix(ip.Reverse, "."),
+		})
+	}
+	sort.Slice(exported.IPs, func(i, j int) bool {
+		return compareIPs(exported.IPs[i].Address, exported.IPs[j].Address) < 0
+	})
+	return exported
+}
@@ -0,0 +1,633 @@
+package run
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"titan-sc/api"
+)
+
+// Manifest change actions
+const (
+	ManifestActionCreate      = "create"
+	ManifestActionReplace     = "replace"
+	ManifestActionRename      = "rename"
+	ManifestActionAttach      = "attach"
+	ManifestActionDetach      = "detach"
+	ManifestActionMove        = "move"
+	ManifestActionUpdate      = "update"
+	ManifestActionEnable      = "enable"
+	ManifestActionDisable     = "disable"
+	ManifestActionUnsupported = "unsupported"
+)
+
+// ManifestChange is a change needed to make the live state match a manifest
+type ManifestChange struct {
+	Resource string `json:"resource"` // ssh_key, network, server, network_member, network_drp, ip, reverse
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Detail   string `json:"detail,omitempty"`
+	Purchase bool   `json:"purchase,omitempty"`
+	Applied  bool   `json:"applied"`
+	Error    string `json:"error,omitempty"`
+
+	apply func(a *manifestApplier) error
+	order *CreateServerInfo // Server bought by a purchase
+}
+
+// ManifestPlan is the ordered list of changes computed by 'plan' and run by 'apply'
+type ManifestPlan struct {
+	CompanyOID  string           `json:"company_oid"`
+	Changes     []ManifestChange `json:"changes"`
+	Purchases   int              `json:"purchases"`
+	Unsupported int              `json:"unsupported"`
+}
+
+// manifestPlanner computes the changes between a manifest and the live state.
+// Problems (unknown references, ambiguous names...) are collected to be reported together.
+type manifestPlanner struct {
+	run      *RunMiddleware
+	manifest *Manifest
+	live     *liveState
+	problems []string
+
+	// Manifest names to live OIDs, empty for resources to create. Server names shared
+	// by several servers of the manifest are ambiguous, and not in serverOIDs.
+	serverOIDs     map[string]string
+	networkOIDs    map[string]string
+	ambiguousNames map[string]bool
+	// Index of valid manifest servers to their live OID, empty for servers to order
+	plannedServers map[int]string
+	liveServers    map[string]*api.ServerDetail
+	templates      *templateResolver
+
+	sshKeys, networks, servers, members, drp, ips, reverses, unsupported []ManifestChange
+}
+
+func (p *manifestPlanner) problem(format string, a ...interface{}) {
+	p.problems = append(p.problems, fmt.Sprintf(format, a...))
+}
+
+// planManifest computes the changes needed to make the live state match the manifest.
+// The changes are ordered: SSH keys, networks, servers, network members, network DRP,
+// IP attachments, reverses. Changes apply cannot do are listed last as unsupported.
+func (run *RunMiddleware) planManifest(manifest *Manifest, live *liveState) (*ManifestPlan, map[string]string, map[string]string, error) {
+	p := &manifestPlanner{
+		run:            run,
+		manifest:       manifest,
+		live:           live,
+		serverOIDs:     map[string]string{},
+		networkOIDs:    map[string]string{},
+		ambiguousNames: map[string]bool{},
+		plannedServers: map[int]string{},
+		liveServers:    map[string]*api.ServerDetail{},
+		templates:      &templateResolver{run: run},
+	}
+	for i := range live.Servers {
+		p.liveServers[live.Servers[i].OID] = &live.Servers[i]
+	}
+
+	p.planSSHKeys()
+	p.planServers()
+	p.planNetworks()
+	p.planIPs()
+	if len(p.problems) > 0 {
+		return nil, nil, nil, fmt.Errorf("invalid manifest:\n  - %s", strings.Join(p.problems, "\n  - "))
+	}
+
+	plan := &ManifestPlan{CompanyOID: live.CompanyOID, Changes: []ManifestChange{}}
+	for _, changes := range [][]ManifestChange{p.sshKeys, p.networks, p.servers, p.members, p.drp, p.ips, p.reverses, p.unsupported} {
+		plan.Changes = append(plan.Changes, changes...)
+	}
+	for _, change := range plan.Changes {
+		if change.Purchase {
+			plan.Purchases++
+		}
+		if change.Action == ManifestActionUnsupported {
+			plan.Unsupported++
+		}
+	}
+	return plan, p.serverOIDs, p.networkOIDs, nil
+}
+
+func (p *manifestPlanner) planSSHKeys() {
+	seen := map[string]bool{}
+	for _, key := range p.manifest.SSHKeys {
+		key := key
+		key.Value = strings.TrimSpace(key.Value)
+		if key.Name == "" || key.Value == "" {
+			p.problem("SSH key '%s': name and value are required", key.Name)
+			continue
+		}
+		if seen[key.Name] {
+			p.problem("SSH key '%s' is defined twice", key.Name)
+			continue
+		}
+		seen[key.Name] = true
+
+		var current *api.SSHKey
+		for i := range p.live.SSHKeys {
+			if p.live.SSHKeys[i].Name == key.Name {
+				current = &p.live.SSHKeys[i]
+				break
+			}
+		}
+		switch {
+		case current == nil:
+			p.sshKeys = append(p.sshKeys, ManifestChange{
+				Resource: "ssh_key", Name: key.Name, Action: ManifestActionCreate,
+				apply: func(a *manifestApplier) error {
+					return apiCallError(a.run.API.PostSSHKeyAdd(key.Name, key.Value))
+				},
+			})
+		case !sameSSHKey(current.Value, key.Value):
+			oldOID, oldValue := current.OID, current.Value
+			p.sshKeys = append(p.sshKeys, ManifestChange{
+				Resource: "ssh_key", Name: key.Name, Action: ManifestActionReplace, Detail: "different key value",
+				apply: func(a *manifestApplier) error {
+					// Key names are unique, so the old key goes first. It is restored if
+					// the new one is refused, so that the name never loses its key.
+					if err := apiCallError(a.run.API.DeleteSSHKey(oldOID)); err != nil {
+						return err
+					}
+					err := apiCallError(a.run.API.PostSSHKeyAdd(key.Name, key.Value))
+					if err == nil {
+						return nil
+					}
+					if restoreErr := apiCallError(a.run.API.PostSSHKeyAdd(key.Name, oldValue)); restoreErr != nil {
+						return fmt.Errorf("%w (the old key could not be restored: %v)", err, restoreErr)
+					}
+					return fmt.Errorf("%w (the old key was restored)", err)
+				},
+			})
+		}
+	}
+}
+
+// sameSSHKey compares the type and data of two public keys, ignoring their comments
+func sameSSHKey(a, b string) bool {
+	fieldsA, fieldsB := strings.Fields(a), strings.Fields(b)
+	if len(fieldsA) < 2 || len(fieldsB) < 2 {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return fieldsA[0] == fieldsB[0] && fieldsA[1] == fieldsB[1]
+}
+
+// planServers plans the servers of the manifest. Servers are identified by OID when
+// set, so that servers sharing a name (as exported) can be described; such names are
+// then ambiguous and the servers are referred to by OID.
+func (p *manifestPlanner) planServers() {
+	seen := map[string]bool{}
+	for i := range p.manifest.Servers {
+		server := &p.manifest.Servers[i]
+		if server.Name == "" {
+			p.problem("server #%d: name is required", i+1)
+			continue
+		}
+		key, what := "name:"+server.Name, "server '"+server.Name+"'"
+		if server.OID != "" {
+			key, what = "oid:"+server.OID, fmt.Sprintf("server '%s' (%s)", server.Name, server.OID)
+		}
+		if seen[key] {
+			p.problem("%s is defined twice", what)
+			continue
+		}
+		seen[key] = true
+
+		current, err := p.findLiveServer(server)
+		if err != nil {
+			p.problem("%s", err)
+			continue
+		}
+		oid := ""
+		if current != nil {
+			oid = current.OID
+		}
+		if _, ok := p.serverOIDs[server.Name]; ok || p.ambiguousNames[server.Name] {
+			p.ambiguousNames[server.Name] = true
+			delete(p.serverOIDs, server.Name)
+		} else {
+			p.serverOIDs[server.Name] = oid
+		}
+		p.plannedServers[i] = oid
+		if current == nil {
+			p.planServerCreate(server)
+			continue
+		}
+		p.planServerUpdate(server, current)
+	}
+}
+
+// findLiveServer returns the live server of a manifest server (by OID, or by name
+// without OID), or nil if it does not exist yet
+func (p *manifestPlanner) findLiveServer(server *ManifestServer) (*api.ServerDetail, error) {
+	if server.OID != "" {
+		if current, ok := p.liveServers[server.OID]; ok {
+			return current, nil
+		}
+		return nil, fmt.Errorf("server '%s': OID %s not found in company %s", server.Name, server.OID, p.live.CompanyOID)
+	}
+	var matches []*api.ServerDetail
+	for i := range p.live.Servers {
+		if p.live.Servers[i].Name == server.Name {
+			matches = append(matches, &p.live.Servers[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("server '%s': several servers have this name, set its oid", server.Name)
+	}
+}
+
+func (p *manifestPlanner) planServerCreate(server *ManifestServer) {
+	info := CreateServerInfo{
+		plan:        server.Plan,
+		sshKeysName: normalizeSSHKeyNames(strings.Join(server.SSHKeys, ",")),
+		quantity:    1,
+		cpu:         server.CPU,
+		ram:         server.RAM,
+		disk:        server.Disk,
+	}
+	if errs := info.validate(); len(errs) > 0 {
+		for _, err := range errs {
+			p.problem("server '%s': %s", server.Name, err)
+		}
+		return
+	}
+	template, err := p.templates.resolve(server.TemplateOID, server.OS, server.OSVersion)
+	if err != nil {
+		p.problem("server '%s': %s", server.Name, err)
+		return
+	}
+	info.templateOID = template.OID
+	if template.Type != OSTypeWindows {
+		if info.sshKeysName == "" {
+			p.problem("server '%s': ssh_keys is required to order it", server.Name)
+			return
+		}
+		for _, name := range sshKeyNames(info.sshKeysName) {
+			if !p.sshKeyExists(name) {
+				p.problem("server '%s': SSH key '%s' not found", server.Name, name)
+			}
+		}
+	}
+
+	name := server.Name
+	if server.Drp != nil && *server.Drp {
+		p.unsupported = append(p.unsupported, ManifestChange{
+			Resource: "server", Name: name, Action: ManifestActionUnsupported,
+			Detail: "drp: enable server DRP from the dashboard once ordered",
+		})
+	}
+	p.servers = append(p.servers, ManifestChange{
+		Resource: "server", Name: name, Action: ManifestActionCreate, Purchase: true,
+		Detail: fmt.Sprintf("%s, %s %s, %s", info.plan, template.OS, template.Version, describeResources(&info)),
+		order:  &info,
+		apply: func(a *manifestApplier) error {
+			oid, err := a.order.orderServer(name, &info)
+			if err != nil {
+				return err
+			}
+			a.serverOIDs[name] = oid
+			return nil
+		},
+	})
+}
+
+// describeResources describes the resources of a server to order, plan minimums by default
+func describeResources(info *CreateServerInfo) string {
+	cpu, ram, disk := info.resources()
+	return fmt.Sprintf("%d CPU, %d GB RAM, %d GB disk", cpu, ram, disk)
+}
+
+func (p *manifestPlanner) sshKeyExists(name string) bool {
+	for _, key := range p.manifest.SSHKeys {
+		if key.Name == name {
+			return true
+		}
+	}
+	for _, key := range p.live.SSHKeys {
+		if key.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *manifestPlanner) planServerUpdate(server *ManifestServer, current *api.ServerDetail) {
+	oid, name := current.OID, server.Name
+	if current.Name != name {
+		p.servers = append(p.servers, ManifestChange{
+			Resource: "server", Name: name, Action: ManifestActionRename,
+			Detail: fmt.Sprintf("%s -> %s", current.Name, name),
+			apply: func(a *manifestApplier) error {
+				return apiCallError(a.run.API.ServerChangeName(name, oid))
+			},
+		})
+	}
+
+	unsupported := func(detail string) {
+		p.unsupported = append(p.unsupported, ManifestChange{
+			Resource: "server", Name: name, Action: ManifestActionUnsupported, Detail: detail,
+		})
+	}
+	if server.Plan != "" && !strings.EqualFold(server.Plan, current.Items.CPU.Plan) {
+		unsupported(fmt.Sprintf("plan %s -> %s: change the plan from the dashboard", current.Items.CPU.Plan, strings.ToUpper(server.Plan)))
+	}
+	cpu, ram, disk := serverResources(current)
+	var resources []string
+	if server.CPU != 0 && server.CPU != cpu {
+		resources = append(resources, fmt.Sprintf("cpu %d -> %d", cpu, server.CPU))
+	}
+	if server.RAM != 0 && server.RAM != ram {
+		resources = append(resources, fmt.Sprintf("ram %d -> %d GB", ram, server.RAM))
+	}
+	if server.Disk != 0 && server.Disk != disk {
+		resources = append(resources, fmt.Sprintf("disk %d -> %d GB", disk, server.Disk))
+	}
+	if len(resources) > 0 {
+		unsupported(strings.Join(resources, ", ") + ": resources are not changed by apply")
+	}
+	if template := current.Items.OS.Template; template != nil {
+		differs := server.TemplateOID != "" && server.TemplateOID != template.OID
+		if server.TemplateOID == "" && server.OS != "" {
+			differs = !strings.EqualFold(server.OS, template.OS) || (server.OSVersion != "" && server.OSVersion != template.Version)
+		}
+		if differs {
+			unsupported(fmt.Sprintf("os %s %s differs: reinstall the server with 'server reset'", template.OS, template.Version))
+		}
+	}
+	if drp := current.Drp != nil && current.Drp.Enabled; server.Drp != nil && *server.Drp != drp {
+		unsupported(fmt.Sprintf("drp %s -> %s: change server DRP from the dashboard", enabledLabel(drp), enabledLabel(*server.Drp)))
+	}
+}
+
+func enabledLabel(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func (p *manifestPlanner) planNetworks() {
+	seen := map[string]bool{}
+	for i := range p.manifest.Networks {
+		network := &p.manifest.Networks[i]
+		if network.Name == "" {
+			p.problem("network #%d: name is required", i+1)
+			continue
+		}
+		if seen[network.Name] {
+			p.problem("network '%s' is defined twice", network.Name)
+			continue
+		}
+		seen[network.Name] = true
+
+		current, err := p.findLiveNetwork(network)
+		if err != nil {
+			p.problem("%s", err)
+			continue
+		}
+		name := network.Name
+		members := map[string]bool{}
+		currentDrp := false
+		if current == nil {
+			p.networkOIDs[name] = ""
+			p.networks = append(p.networks, ManifestChange{
+				Resource: "network", Name: name, Action: ManifestActionCreate,
+				apply: func(a *manifestApplier) error {
+					created, err := a.run.API.CreateNetwork(&api.NetworkCreate{Name: name, CompanyOID: a.companyOID})
+					if err != nil {
+						return err
+					}
+					a.networkOIDs[name] = created.OID
+					return nil
+				},
+			})
+		} else {
+			oid := current.OID
+			p.networkOIDs[name] = oid
+			if current.Name != name {
+				p.networks = append(p.networks, ManifestChange{
+					Resource: "network", Name: name, Action: ManifestActionRename,
+					Detail: fmt.Sprintf("%s -> %s", current.Name, name),
+					apply: func(a *manifestApplier) error {
+						return apiCallError(a.run.API.NetworkRename(oid, name))
+					},
+				})
+			}
+			for _, iface := range current.Interfaces {
+				members[iface.Server.OID] = true
+			}
+			currentDrp = current.Drp != nil && current.Drp.Enabled
+		}
+
+		p.planNetworkMembers(network, members)
+
+		if network.Drp != nil && *network.Drp != currentDrp {
+			action, call := ManifestActionEnable, func(a *manifestApplier, oid string) error {
+				_, err := a.run.API.DrpNetworkEnable(oid)
+				return err
+			}
+			if !*network.Drp {
+				action, call = ManifestActionDisable, func(a *manifestApplier, oid string) error {
+					_, err := a.run.API.DrpNetworkDisable(oid)
+					return err
+				}
+			}
+			p.drp = append(p.drp, ManifestChange{
+				Resource: "network_drp", Name: name, Action: action,
+				apply: func(a *manifestApplier) error {
+					return call(a, a.networkOIDs[name])
+				},
+			})
+		}
+	}
+}
+
+func (p *manifestPlanner) findLiveNetwork(network *ManifestNetwork) (*api.NetworkDetail, error) {
+	var matches []*api.NetworkDetail
+	for i := range p.live.Networks {
+		current := &p.live.Networks[i]
+		if (network.OID != "" && current.OID == network.OID) || (network.OID == "" && current.Name == network.Name) {
+			matches = append(matches, current)
+		}
+	}
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) > 1:
+		return nil, fmt.Errorf("network '%s': several networks have this name, set its oid", network.Name)
+	case network.OID != "":
+		return nil, fmt.Errorf("network '%s': OID %s not found in company %s", network.Name, network.OID, p.live.CompanyOID)
+	}
+	return nil, nil
+}
+
+// planNetworkMembers detaches the servers not listed by the network, then attaches the missing ones
+func (p *manifestPlanner) planNetworkMembers(network *ManifestNetwork, members map[string]bool) {
+	networkName := network.Name
+	wanted := map[string]bool{}
+	var attach []string
+	for _, serverName := range network.Servers {
+		oid, err := p.serverOIDByRef(serverName)
+		if err != nil {
+			p.problem("network '%s': %s", networkName, err)
+			continue
+		}
+		if oid != "" {
+			wanted[oid] = true
+		}
+		if oid == "" || !members[oid] {
+			attach = append(attach, serverName)
+		}
+	}
+
+	var detach []string
+	for oid := range members {
+		if !wanted[oid] {
+			detach = append(detach, oid)
+		}
+	}
+	sort.Strings(detach)
+	for _, oid := range detach {
+		oid := oid
+		serverName := oid
+		if server, ok := p.liveServers[oid]; ok {
+			serverName = server.Name
+		}
+		p.members = append(p.members, ManifestChange{
+			Resource: "network_member", Name: networkName, Action: ManifestActionDetach, Detail: serverName,
+			apply: func(a *manifestApplier) error {
+				return apiCallError(a.run.API.NetworkDetachServer(a.networkOIDs[networkName], oid))
+			},
+		})
+	}
+	for _, serverName := range attach {
+		serverName := serverName
+		p.members = append(p.members, ManifestChange{
+			Resource: "network_member", Name: networkName, Action: ManifestActionAttach, Detail: serverName,
+			apply: func(a *manifestApplier) error {
+				oid, err := a.serverOID(serverName)
+				if err != nil {
+					return err
+				}
+				return apiCallError(a.run.API.NetworkAttachServers(a.networkOIDs[networkName], []string{oid}))
+			},
+		})
+	}
+}
+
+// serverOIDByRef returns the OID of a server given by name or OID: a server of the
+// manifest (empty if it is to be ordered) or a live server not described by the manifest
+func (p *manifestPlanner) serverOIDByRef(name string) (string, error) {
+	if p.ambiguousNames[name] {
+		return "", fmt.Errorf("several servers of the manifest are named '%s', refer to it by oid", name)
+	}
+	if oid, ok := p.serverOIDs[name]; ok {
+		return oid, nil
+	}
+	if _, ok := p.liveServers[name]; ok {
+		return name, nil
+	}
+	var matches []string
+	for _, server := range p.live.Servers {
+		if server.Name == name {
+			matches = append(matches, server.OID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("server '%s' not found", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("several servers are named '%s', describe it in servers with its oid", name)
+	}
+}
+
+func (p *manifestPlanner) planIPs() {
+	seen := map[string]string{}
+	for i, server := range p.manifest.Servers {
+		serverName := server.Name
+		serverOID, ok := p.plannedServers[i]
+		if !ok {
+			// Invalid server, already reported
+			continue
+		}
+		// Existing servers are referred to by OID, as their name may be shared
+		serverRef := serverOID
+		if serverRef == "" {
+			serverRef = serverName
+		}
+		for _, entry := range server.IPs {
+			if net.ParseIP(strings.TrimSpace(entry.Address)) == nil {
+				p.problem("server '%s': invalid IP address '%s'", serverName, entry.Address)
+				continue
+			}
+			ip := findCompanyIP(p.live.IPs, entry.Address)
+			if ip == nil {
+				p.problem("server '%s': IP %s not found in company %s", serverName, entry.Address, p.live.CompanyOID)
+				continue
+			}
+			address := normalizeIP(ip.Address)
+			if other, ok := seen[address]; ok {
+				p.problem("IP %s is listed for servers '%s' and '%s'", address, other, serverName)
+				continue
+			}
+			seen[address] = serverName
+
+			if serverOID == "" || ip.ServerOID != serverOID {
+				p.ips = append(p.ips, p.ipAttachChange(ip, serverRef, serverName))
+			}
+			if entry.Reverse != "" && !sameHostname(ip.Reverse, entry.Reverse) {
+				ipOID, reverse := ip.OID, strings.TrimSuffix(entry.Reverse, ".")
+				current := ip.Reverse
+				if current == "" {
+					current = `""`
+				}
+				p.reverses = append(p.reverses, ManifestChange{
+					Resource: "reverse", Name: address, Action: ManifestActionUpdate,
+					Detail: fmt.Sprintf("%s -> %s", current, reverse),
+					apply: func(a *manifestApplier) error {
+						return apiCallError(a.run.API.IPUpdateReverse(ipOID, reverse))
+					},
+				})
+			}
+		}
+	}
+}
+
+// ipAttachChange attaches an IP to a server, given by name or OID, moving it (with
+// rollback) if it is attached to another server
+func (p *manifestPlanner) ipAttachChange(ip *api.IP, serverRef, serverName string) ManifestChange {
+	address, ownerOID, ownerName := normalizeIP(ip.Address), ip.ServerOID, ip.ServerName
+	if ownerOID == "" {
+		return ManifestChange{
+			Resource: "ip", Name: address, Action: ManifestActionAttach, Detail: "to " + serverName,
+			apply: func(a *manifestApplier) error {
+				oid, err := a.serverOID(serverRef)
+				if err != nil {
+					return err
+				}
+				return apiCallError(a.run.API.IPAttach(oid, []string{ip.Address}))
+			},
+		}
+	}
+	return ManifestChange{
+		Resource: "ip", Name: address, Action: ManifestActionMove, Detail: fmt.Sprintf("from %s to %s", ownerName, serverName),
+		apply: func(a *manifestApplier) error {
+			oid, err := a.serverOID(serverRef)
+			if err != nil {
+				return err
+			}
+			result := &IPMoveResult{IP: ip.Address, FromServerOID: ownerOID, FromServerName: ownerName, ToServerOID: oid, ToServerName: serverName}
+			return a.run.moveIP(a.companyOID, result, a.timeout)
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package run
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of cart amounts, which the API returns in cents
+const DefaultCurrency = "EUR"
+
+// formatMoney formats an amount in cents with thousands separators and its
+// currency, e.g. "1,234.56 EUR"
+func formatMoney(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	units := strconv.FormatInt(cents/100, 10)
+	var grouped strings.Builder
+	for i, digit := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return fmt.Sprintf("%s%s.%02d %s", sign, grouped.String(), cents%100, currency)
+}
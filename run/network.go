@@ -117,10 +117,7 @@ func (run *RunMiddleware) NetworkAttachServer(cmd *cobra.Command, args []string)
 	networkOID, _ := cmd.Flags().GetString("network-oid")
 	serverOID, _ := cmd.Flags().GetString("server-oid")
 
-	act := api.NetworkOps{
-		ServerOIDs: []string{serverOID},
-	}
-	_, apiReturn, err := run.API.SendRequestToAPI(api.HTTPPut, "/network/switch/"+networkOID+"/attach", act)
+	apiReturn, err := run.API.NetworkAttachServers(networkOID, []string{serverOID})
 	if err != nil {
 		run.handleErrorAndGenericOutput(apiReturn, err)
 		return
@@ -145,10 +142,7 @@ func (run *RunMiddleware) NetworkDetachServer(cmd *cobra.Command, args []string)
 	networkOID, _ := cmd.Flags().GetString("network-oid")
 	serverOID, _ := cmd.Flags().GetString("server-oid")
 
-	act := api.NetworkOps{
-		ServerOID: serverOID,
-	}
-	_, apiReturn, err := run.API.SendRequestToAPI(api.HTTPPut, "/network/switch/"+networkOID+"/detach", act)
+	apiReturn, err := run.API.NetworkDetachServer(networkOID, serverOID)
 	if err != nil {
 		run.handleErrorAndGenericOutput(apiReturn, err)
 		return
@@ -306,8 +300,7 @@ func (run *RunMiddleware) NetworkRename(cmd *cobra.Command, args []string) {
 	networkOID, _ := cmd.Flags().GetString("network-oid")
 	name, _ := cmd.Flags().GetString("name")
 
-	netRename := &api.NetworkRename{Name: name}
-	_, apiReturn, err := run.API.SendRequestToAPI(api.HTTPPut, "/network/switch/"+networkOID, netRename)
+	apiReturn, err := run.API.NetworkRename(networkOID, name)
 	if err != nil {
 		run.OutputError(err)
 		return
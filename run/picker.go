@@ -0,0 +1,250 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// pickerMaxVisible is the number of options displayed at once by the picker
+const pickerMaxVisible = 10
+
+var (
+	ErrPickerCancelled = errors.New("selection cancelled")
+	ErrPickerNoOptions = errors.New("nothing to select")
+)
+
+// PickerOption is a single entry of the interactive picker.
+// Value is returned when selected, Description is only displayed and searched.
+type PickerOption struct {
+	Value       string
+	Description string
+}
+
+// IsInteractive returns true when the CLI can prompt the user:
+// stdin and stdout must both be terminals and JSON output must be disabled.
+func (run *RunMiddleware) IsInteractive() bool {
+	if run.JSONOutput {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Pick displays a fuzzy-search selector and returns the value of the chosen option.
+// Typing filters the list, arrows (or Ctrl-P/Ctrl-N) move the cursor, Enter selects
+// and Esc or Ctrl-C cancels. The picker is drawn on stderr to keep stdout clean.
+func (run *RunMiddleware) Pick(title string, options []PickerOption) (string, error) {
+	if len(options) == 0 {
+		return "", ErrPickerNoOptions
+	}
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, oldState)
+
+	p := &picker{
+		run:     run,
+		title:   title,
+		options: options,
+		matches: fuzzyFilter("", options),
+	}
+	defer p.clear()
+
+	buf := make([]byte, 64)
+	for {
+		p.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		done, err := p.handleInput(buf[:n])
+		if err != nil {
+			return "", err
+		}
+		if done {
+			return p.matches[p.cursor].Value, nil
+		}
+	}
+}
+
+type picker struct {
+	run     *RunMiddleware
+	title   string
+	query   string
+	options []PickerOption
+	matches []PickerOption
+	cursor  int
+	offset  int
+	lines   int
+}
+
+// handleInput processes a chunk of raw terminal input.
+// Returns true once an option has been selected.
+func (p *picker) handleInput(input []byte) (bool, error) {
+	for len(input) > 0 {
+		switch {
+		case input[0] == 3: // Ctrl-C
+			return false, ErrPickerCancelled
+		case input[0] == 27 && len(input) >= 3 && input[1] == '[':
+			switch input[2] {
+			case 'A':
+				p.move(-1)
+			case 'B':
+				p.move(1)
+			}
+			input = input[3:]
+			continue
+		case input[0] == 27: // Esc alone
+			return false, ErrPickerCancelled
+		case input[0] == '\r' || input[0] == '\n':
+			if len(p.matches) == 0 {
+				input = input[1:]
+				continue
+			}
+			return true, nil
+		case input[0] == 16: // Ctrl-P
+			p.move(-1)
+		case input[0] == 14: // Ctrl-N
+			p.move(1)
+		case input[0] == 127 || input[0] == 8: // Backspace
+			if p.query != "" {
+				_, size := utf8.DecodeLastRuneInString(p.query)
+				p.setQuery(p.query[:len(p.query)-size])
+			}
+		case input[0] == 21: // Ctrl-U
+			p.setQuery("")
+		default:
+			r, size := utf8.DecodeRune(input)
+			if unicode.IsPrint(r) {
+				p.setQuery(p.query + string(r))
+			}
+			input = input[size:]
+			continue
+		}
+		input = input[1:]
+	}
+	return false, nil
+}
+
+func (p *picker) setQuery(query string) {
+	p.query = query
+	p.matches = fuzzyFilter(query, p.options)
+	p.cursor = 0
+	p.offset = 0
+}
+
+func (p *picker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.cursor = (p.cursor + delta + len(p.matches)) % len(p.matches)
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+pickerMaxVisible {
+		p.offset = p.cursor - pickerMaxVisible + 1
+	}
+}
+
+// render redraws the picker below the prompt line and leaves the cursor after the query
+func (p *picker) render() {
+	p.clear()
+
+	lines := []string{fmt.Sprintf("%s %s: %s", p.run.Colorize("?", "green"), p.title, p.query)}
+	end := p.offset + pickerMaxVisible
+	if end > len(p.matches) {
+		end = len(p.matches)
+	}
+	for i := p.offset; i < end; i++ {
+		opt := p.matches[i]
+		line := opt.Value
+		if opt.Description != "" {
+			line += "  " + p.run.Colorize(opt.Description, "dim")
+		}
+		if i == p.cursor {
+			lines = append(lines, p.run.Colorize("> ", "cyan")+line)
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	if len(p.matches) == 0 {
+		lines = append(lines, p.run.Colorize("  (no match)", "dim"))
+	} else {
+		lines = append(lines, p.run.Colorize(fmt.Sprintf("  %d/%d", len(p.matches), len(p.options)), "dim"))
+	}
+
+	fmt.Fprint(os.Stderr, strings.Join(lines, "\r\n"))
+	p.lines = len(lines)
+
+	// Move back up to the prompt line, right after the query
+	fmt.Fprintf(os.Stderr, "\033[%dA\r\033[%dC", p.lines-1, displayWidth(p.title)+displayWidth(p.query)+4)
+}
+
+// clear erases everything drawn by the picker, the cursor is expected on the prompt line
+func (p *picker) clear() {
+	fmt.Fprint(os.Stderr, "\r\033[J")
+}
+
+// fuzzyFilter returns the options matching query as a subsequence (case-insensitive),
+// best matches first. An empty query matches everything in the original order.
+func fuzzyFilter(query string, options []PickerOption) []PickerOption {
+	if query == "" {
+		return options
+	}
+
+	type scored struct {
+		option PickerOption
+		score  int
+	}
+	var results []scored
+	for _, opt := range options {
+		if score, ok := fuzzyScore(strings.ToLower(query), strings.ToLower(opt.Value+" "+opt.Description)); ok {
+			results = append(results, scored{option: opt, score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	matches := make([]PickerOption, 0, len(results))
+	for _, r := range results {
+		matches = append(matches, r.option)
+	}
+	return matches
+}
+
+// fuzzyScore checks that every rune of query appears in text in order.
+// Consecutive matches and matches at word starts score higher.
+func fuzzyScore(query, text string) (int, bool) {
+	score := 0
+	queryRunes := []rune(query)
+	qi := 0
+	prevMatched := false
+	prev := ' '
+	for _, r := range text {
+		if qi < len(queryRunes) && r == queryRunes[qi] {
+			score++
+			if prevMatched {
+				score += 2
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+			qi++
+			prevMatched = true
+		} else {
+			prevMatched = false
+		}
+		prev = r
+	}
+	return score, qi == len(queryRunes)
+}
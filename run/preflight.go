@@ -0,0 +1,179 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// serverPreflight collects the problems found before a server is ordered or reset,
+// so that they are all reported together before any cart is created
+type serverPreflight struct {
+	run      *RunMiddleware
+	problems []string
+
+	// Set while checking a server of a spec file, to tell which one has the problem
+	label string
+
+	keys    []api.SSHKey
+	keysErr error
+	loaded  bool
+}
+
+func (p *serverPreflight) add(format string, a ...interface{}) {
+	problem := fmt.Sprintf(format, a...)
+	if p.label != "" {
+		problem = fmt.Sprintf("server '%s': %s", p.label, problem)
+	}
+	p.problems = append(p.problems, problem)
+}
+
+// err returns the problems found, if any, as a single error
+func (p *serverPreflight) err(what string) error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s:\n  - %s", what, strings.Join(p.problems, "\n  - "))
+}
+
+// template fetches a template and checks that it can be installed: it is enabled,
+// and Windows templates come with their license. It returns nil if not found.
+func (p *serverPreflight) template(templateOID string) *api.Template {
+	template, err := p.run.API.GetTemplateByOID(templateOID)
+	if err != nil {
+		p.add("template %s: %s", templateOID, err)
+		return nil
+	}
+	p.checkTemplate(template)
+	return template
+}
+
+func (p *serverPreflight) checkTemplate(template *api.Template) {
+	name := strings.TrimSpace(template.OS + " " + template.Version)
+	if !template.Enabled {
+		p.add("template %s (%s) is disabled", name, template.OID)
+	}
+	if template.Type == OSTypeWindows && (template.HasLicense == nil || !*template.HasLicense) {
+		p.add("Windows template %s (%s) has no license", name, template.OID)
+	}
+}
+
+// auth checks the login of a new server: SSH keys exist and, except on Windows
+// where they are not installed, a password or SSH keys are given
+func (p *serverPreflight) auth(template *api.Template, password, sshKeysName string) {
+	if template != nil && template.Type == OSTypeWindows {
+		if sshKeysName != "" {
+			p.add("SSH keys are not installed on Windows template %s, remove --ssh-keys-name", template.OID)
+		}
+		return
+	}
+	if password == "" && sshKeysName == "" {
+		p.add("a password or SSH keys are required")
+	}
+	p.sshKeys(sshKeysName)
+}
+
+// sshKeys checks that the SSH keys given by name exist
+func (p *serverPreflight) sshKeys(sshKeysName string) {
+	if len(sshKeyNames(sshKeysName)) == 0 {
+		return
+	}
+	if !p.loaded {
+		p.loaded = true
+		var user *api.User
+		if user, p.keysErr = p.run.API.GetUserInfos(); p.keysErr == nil {
+			p.keys, p.keysErr = p.run.API.GetSSHKeyList(user.OID)
+		}
+	}
+	if p.keysErr != nil {
+		p.add("SSH keys: %s", p.keysErr)
+		return
+	}
+	for _, name := range sshKeyNames(sshKeysName) {
+		if !sshKeyNameExists(p.keys, name) {
+			p.add("SSH key '%s' not found", name)
+		}
+	}
+}
+
+// resources checks the plan and the resources of a new server
+func (p *serverPreflight) resources(info *CreateServerInfo) {
+	for _, err := range info.validate() {
+		p.add("%s", err)
+	}
+	if info.quantity < 1 {
+		p.add("quantity must be at least 1, got %d", info.quantity)
+	}
+}
+
+// payment checks that the company can pay: it is enabled and has a payment method,
+// and the subscription to add the servers to is ongoing and belongs to the company
+func (p *serverPreflight) payment(companyOID, paymentMethodOID, subscriptionOID string) {
+	company, err := p.run.API.GetCompanyDetails(companyOID)
+	if err != nil {
+		p.add("company %s: %s", companyOID, err)
+		return
+	}
+	if company.Disable {
+		p.add("company %s is disabled", company.Name)
+	}
+	if paymentMethodOID == "" && (company.DefaultPaymentMethod == nil || *company.DefaultPaymentMethod == "") {
+		p.add("company %s has no default payment method, use --payment-method", company.Name)
+	}
+
+	if subscriptionOID == "" {
+		return
+	}
+	subscription, err := p.run.API.GetSubscription(subscriptionOID)
+	if err != nil {
+		p.add("subscription %s: %s", subscriptionOID, err)
+		return
+	}
+	if subscription.CompanyOID != "" && subscription.CompanyOID != companyOID {
+		p.add("subscription %s belongs to another company", subscriptionOID)
+	}
+	if subscription.State != "ongoing" {
+		p.add("subscription %s is %s, not ongoing", subscriptionOID, subscription.State)
+	}
+	if subscription.PaymentDisabled {
+		p.add("payment is disabled on subscription %s", subscriptionOID)
+	}
+}
+
+// preflightServerCreate checks a 'server create' order before any cart is created:
+// plan and resources, template, login and, unless only quoted, payment
+func (run *RunMiddleware) preflightServerCreate(cmd *cobra.Command, info *CreateServerInfo, companyOID string) error {
+	p := &serverPreflight{run: run}
+	p.resources(info)
+	template := p.template(info.templateOID)
+	p.auth(template, info.password, info.sshKeysName)
+	if !isQuoteOnly(cmd) {
+		run.preflightPayment(cmd, p, companyOID)
+	}
+	return p.err("cannot create server")
+}
+
+// preflightServerReset checks a 'server reset': the server exists, the template can
+// be installed, with a license on the server if it requires one, and the SSH keys exist
+func (run *RunMiddleware) preflightServerReset(serverOID, templateOID, sshKeysName string) error {
+	p := &serverPreflight{run: run}
+	server, apiReturn, err := run.API.GetServerOID(serverOID)
+	if err = apiCallError(apiReturn, err); err != nil {
+		p.add("server %s: %s", serverOID, err)
+	}
+	template := p.template(templateOID)
+	if server != nil && template != nil && template.HasLicense != nil && *template.HasLicense && server.Items.License == nil {
+		p.add("template %s requires a license that server %s does not have, order a new server instead", template.OID, server.Name)
+	}
+	p.sshKeys(sshKeysName)
+	return p.err("cannot reset server")
+}
+
+// preflightPayment checks the payment method and subscription given by the flags of cmd
+func (run *RunMiddleware) preflightPayment(cmd *cobra.Command, p *serverPreflight, companyOID string) {
+	paymentMethodOID, _ := cmd.Flags().GetString("payment-method")
+	subscriptionOID, _ := cmd.Flags().GetString("subscription-oid")
+	p.payment(companyOID, paymentMethodOID, subscriptionOID)
+}
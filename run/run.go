@@ -14,11 +14,16 @@ import (
 
 // State List
 const (
-	StateCreating = "creating"
-	StateCreated  = "created"
-	StateDeleted  = "deleted"
-	StateStarted  = "started"
-	StateStopped  = "stopped"
+	StateCreating  = "creating"
+	StateCreated   = "created"
+	StateDeleted   = "deleted"
+	StateStarted   = "started"
+	StateStopped   = "stopped"
+	StateStarting  = "starting"
+	StateStopping  = "stopping"
+	StateUnmanaged = "unmanaged"
+	StateError     = "error"
+	StateFailed    = "failed"
 )
 
 type RunMiddleware struct {
@@ -27,6 +32,12 @@ type RunMiddleware struct {
 	CLIVersion string
 	CLIos      string
 	API        *api.API
+
+	// Configuration profile, its purchase budget, the purchase log and the local cart
+	Profile         string
+	Budget          Budget
+	PurchaseLogPath string
+	CartPath        string
 }
 
 func NewRunMiddleware(api *api.API) *RunMiddleware {
@@ -140,6 +151,13 @@ func (run *RunMiddleware) OutputError(err error) {
 	}
 }
 
+// OutputErrorAndExit outputs the error and exits with a non-zero status.
+// Use it for commands whose exit code is meaningful to scripts (wait, checks, ...).
+func (run *RunMiddleware) OutputErrorAndExit(err error) {
+	run.OutputError(err)
+	os.Exit(1)
+}
+
 func (run *RunMiddleware) printAPIReturn(apiReturn *api.Return) {
 	if run.JSONOutput {
 		printAsJson(apiReturn)
@@ -207,13 +225,13 @@ func getStateColor(state string) string {
 	case StateStarted, StateCreated, "ongoing", "active", "enabled", "connected", "attached", "up":
 		return "\033[1;32m"
 	// In-progress/transitional states - ORANGE
-	case StateCreating, "starting", "stopping", "pending", "processing", "updating", "deleting":
+	case StateCreating, StateStarting, StateStopping, "pending", "processing", "updating", "deleting":
 		return "\033[38;5;208m"
 	// Warning/paused states - YELLOW
-	case StateStopped, "paused", "suspended", "unmanaged":
+	case StateStopped, "paused", "suspended", StateUnmanaged:
 		return "\033[1;33m"
 	// Error/negative states - RED
-	case StateDeleted, "cancelled", "canceled", "failed", "error", "disabled", "down":
+	case StateDeleted, "cancelled", "canceled", StateFailed, StateError, "disabled", "down":
 		return "\033[1;31m"
 	default:
 		return ""
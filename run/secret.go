@@ -0,0 +1,200 @@
+package run
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// GeneratedPasswordLength is the length of the passwords made by --generate-password
+const GeneratedPasswordLength = 24
+
+// Characters of generated passwords: every class is used at least once
+var passwordClasses = []string{
+	"abcdefghijkmnopqrstuvwxyz",
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"23456789",
+	"-_.+=@%",
+}
+
+// ReadSecretFlag returns a secret given by one of the flags added by the cmd
+// addSecretFlags helper: --NAME, --NAME-stdin, --NAME-file or --generate-NAME.
+// A generated secret is printed once on stderr, or written to --NAME-output.
+// It returns an empty string when none of them is set.
+func (run *RunMiddleware) ReadSecretFlag(cmd *cobra.Command, name string) (string, error) {
+	flags := cmd.Flags()
+	if flags.Changed(name + "-output") {
+		if generate, _ := flags.GetBool("generate-" + name); !generate {
+			return "", fmt.Errorf("--%s-output requires --generate-%s", name, name)
+		}
+	}
+
+	if fromStdin, _ := flags.GetBool(name + "-stdin"); fromStdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("--%s-stdin: %w", name, err)
+		}
+		return nonEmptySecret(name, string(data))
+	}
+	if path, _ := flags.GetString(name + "-file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("--%s-file: %w", name, err)
+		}
+		return nonEmptySecret(name, string(data))
+	}
+	if generate, _ := flags.GetBool("generate-" + name); generate {
+		secret, err := GeneratePassword(GeneratedPasswordLength)
+		if err != nil {
+			return "", err
+		}
+		output, _ := flags.GetString(name + "-output")
+		if err = revealSecret(name, secret, output); err != nil {
+			return "", err
+		}
+		return secret, nil
+	}
+	secret, _ := flags.GetString(name)
+	return secret, nil
+}
+
+// nonEmptySecret strips the line ending of a secret read from stdin or from a file
+func nonEmptySecret(name, data string) (string, error) {
+	secret := strings.TrimRight(data, "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", name)
+	}
+	return secret, nil
+}
+
+// revealSecret prints a generated secret once on stderr, out of the JSON output, or
+// writes it to a new file only readable by the user
+func revealSecret(name, secret, output string) error {
+	if output == "" {
+		_, err := fmt.Fprintf(os.Stderr, "Generated %s (shown only once): %s\n", name, secret)
+		return err
+	}
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("--%s-output: %w", name, err)
+	}
+	if _, err = file.WriteString(secret + "\n"); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stderr, "Generated %s written to %s\n", name, output)
+	return err
+}
+
+// GeneratePassword returns a random password of length characters with lowercase and
+// uppercase letters, digits and symbols, from the cryptographic random generator
+func GeneratePassword(length int) (string, error) {
+	if length < len(passwordClasses) {
+		return "", fmt.Errorf("password length must be at least %d", len(passwordClasses))
+	}
+	password := make([]byte, length)
+	for i, class := range passwordClasses {
+		c, err := randomChar(class)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+	all := strings.Join(passwordClasses, "")
+	for i := len(passwordClasses); i < length; i++ {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	// Shuffle so that the guaranteed characters are not always first
+	for i := length - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+func randomChar(chars string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, err
+	}
+	return chars[n.Int64()], nil
+}
+
+// PromptSecret reads a secret from the terminal without echoing it. With confirm,
+// the secret is asked twice.
+func (run *RunMiddleware) PromptSecret(prompt string, confirm bool) (string, error) {
+	if !run.IsInteractive() {
+		return "", errors.New("cannot prompt for a secret: not running in a terminal")
+	}
+	secret, err := readHiddenLine(prompt + ": ")
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", errors.New("empty secret")
+	}
+	if confirm {
+		again, err := readHiddenLine("Confirm " + strings.ToLower(prompt[:1]) + prompt[1:] + ": ")
+		if err != nil {
+			return "", err
+		}
+		if again != secret {
+			return "", errors.New("secrets do not match")
+		}
+	}
+	return secret, nil
+}
+
+func readHiddenLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// passwordFlag returns the password given by the secret flags of --password. When the
+// order is only quoted (--dry-run, --quote), --generate-password makes a throwaway
+// password for the quote cart, which is neither printed nor written to --password-output.
+func (run *RunMiddleware) passwordFlag(cmd *cobra.Command) (string, error) {
+	if generate, _ := cmd.Flags().GetBool("generate-password"); generate && isQuoteOnly(cmd) {
+		return GeneratePassword(GeneratedPasswordLength)
+	}
+	return run.ReadSecretFlag(cmd, "password")
+}
+
+// loginPassword returns the login password of a server to create or reset, from the
+// secret flags of --password. It is prompted for in a terminal when the server has
+// no SSH keys and its template is not Windows.
+func (run *RunMiddleware) loginPassword(cmd *cobra.Command, sshKeysName, templateOID string) (string, error) {
+	password, err := run.passwordFlag(cmd)
+	if err != nil || password != "" || sshKeysName != "" || !run.IsInteractive() {
+		return password, err
+	}
+	// A template that cannot be fetched is reported by the preflight checks
+	template, err := run.API.GetTemplateByOID(templateOID)
+	if err != nil || template.Type == OSTypeWindows {
+		return "", nil
+	}
+	return run.PromptSecret("Password for login", true)
+}
@@ -0,0 +1,216 @@
+package run
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"titan-sc/api"
+)
+
+// Selector keys
+const (
+	SelectorName       = "name"
+	SelectorState      = "state"
+	SelectorPlan       = "plan"
+	SelectorOS         = "os"
+	SelectorSite       = "site"
+	SelectorTag        = "tag"
+	SelectorDrp        = "drp"
+	SelectorHypervisor = "hypervisor"
+)
+
+// DRP selector values
+const (
+	DrpSelectorEnabled  = "enabled"
+	DrpSelectorDisabled = "disabled"
+	DrpSelectorError    = "error"
+)
+
+var selectorKeys = []string{SelectorName, SelectorState, SelectorPlan, SelectorOS, SelectorSite, SelectorTag, SelectorDrp, SelectorHypervisor}
+
+// ServerSelector filters servers from ServerList results.
+// All criteria must match (AND); each criterion accepts several values (OR).
+// Empty criteria match everything.
+type ServerSelector struct {
+	Names  []string // Glob patterns on server name
+	States []string
+	Plans  []string
+	OS     []string // Glob patterns on "os" or "os version"
+	Sites  []string // Public (main/secondary) or internal site names
+	Tags   []string
+	Drp    []string // enabled, disabled, error
+	// Hypervisor OIDs or glob patterns on hypervisor hostnames
+	Hypervisors []string
+	// NameRegexp, when set, must match the server name
+	NameRegexp *regexp.Regexp
+}
+
+// ParseServerSelector parses a selector expression such as
+// "name=web-*,state=started|stopped,tag=web,drp=enabled".
+// Keys: name, state, plan, os, site, tag, drp, hypervisor. Alternatives are separated by '|'.
+func ParseServerSelector(expr string) (*ServerSelector, error) {
+	selector := &ServerSelector{}
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid selector '%s': expected key=value", part)
+		}
+		var values []string
+		for _, v := range strings.Split(value, "|") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if err := selector.Add(strings.ToLower(strings.TrimSpace(key)), values...); err != nil {
+			return nil, err
+		}
+	}
+	return selector, nil
+}
+
+// Add appends values to the criterion identified by key
+func (s *ServerSelector) Add(key string, values ...string) error {
+	switch key {
+	case SelectorName:
+		for _, v := range values {
+			if _, err := path.Match(v, ""); err != nil {
+				return fmt.Errorf("invalid name pattern '%s': %w", v, err)
+			}
+		}
+		s.Names = append(s.Names, values...)
+	case SelectorState:
+		s.States = append(s.States, values...)
+	case SelectorPlan:
+		s.Plans = append(s.Plans, values...)
+	case SelectorOS:
+		s.OS = append(s.OS, values...)
+	case SelectorSite:
+		s.Sites = append(s.Sites, values...)
+	case SelectorTag:
+		s.Tags = append(s.Tags, values...)
+	case SelectorDrp:
+		for _, v := range values {
+			v = strings.ToLower(v)
+			if v != DrpSelectorEnabled && v != DrpSelectorDisabled && v != DrpSelectorError {
+				return fmt.Errorf("invalid drp value '%s': must be enabled, disabled or error", v)
+			}
+			s.Drp = append(s.Drp, v)
+		}
+	case SelectorHypervisor:
+		s.Hypervisors = append(s.Hypervisors, values...)
+	default:
+		return fmt.Errorf("unknown selector key '%s': must be one of %s", key, strings.Join(selectorKeys, ", "))
+	}
+	return nil
+}
+
+// Match returns true if the server matches every criterion of the selector
+func (s *ServerSelector) Match(server *api.ServerDetail) bool {
+	if len(s.Names) > 0 && !matchAny(s.Names, func(p string) bool { return globMatch(p, server.Name) }) {
+		return false
+	}
+	if s.NameRegexp != nil && !s.NameRegexp.MatchString(server.Name) {
+		return false
+	}
+	if len(s.States) > 0 && !matchAny(s.States, func(v string) bool { return strings.EqualFold(v, serverState(server)) }) {
+		return false
+	}
+	if len(s.Plans) > 0 && !matchAny(s.Plans, func(v string) bool { return strings.EqualFold(v, server.Items.CPU.Plan) }) {
+		return false
+	}
+	if len(s.OS) > 0 && !matchAny(s.OS, func(p string) bool { return matchServerOS(p, server) }) {
+		return false
+	}
+	if len(s.Sites) > 0 && !matchAny(s.Sites, func(v string) bool {
+		return strings.EqualFold(mapSiteToPublic(v), mapSiteToPublic(server.Site))
+	}) {
+		return false
+	}
+	if len(s.Tags) > 0 && !matchAny(s.Tags, func(v string) bool { return serverHasTag(server, v) }) {
+		return false
+	}
+	if len(s.Drp) > 0 && !matchAny(s.Drp, func(v string) bool { return v == serverDrpSelectorValue(server) }) {
+		return false
+	}
+	if len(s.Hypervisors) > 0 && !matchAny(s.Hypervisors, func(v string) bool { return matchServerHypervisor(v, server) }) {
+		return false
+	}
+	return true
+}
+
+// Filter returns the servers matching the selector
+func (s *ServerSelector) Filter(servers []api.ServerDetail) []api.ServerDetail {
+	matched := make([]api.ServerDetail, 0, len(servers))
+	for i := range servers {
+		if s.Match(&servers[i]) {
+			matched = append(matched, servers[i])
+		}
+	}
+	return matched
+}
+
+func matchAny(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches a shell glob pattern case-insensitively
+func globMatch(pattern, value string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return ok
+}
+
+func matchServerOS(pattern string, server *api.ServerDetail) bool {
+	template := server.Items.OS.Template
+	if template == nil {
+		return false
+	}
+	return globMatch(pattern, template.OS) || globMatch(pattern, template.OS+" "+template.Version)
+}
+
+func matchServerHypervisor(pattern string, server *api.ServerDetail) bool {
+	if strings.EqualFold(pattern, server.Hypervisor) {
+		return true
+	}
+	return server.Material != nil && globMatch(pattern, server.Material.Hostname)
+}
+
+func serverHasTag(server *api.ServerDetail, tag string) bool {
+	for _, t := range server.TagInfo {
+		if strings.EqualFold(t.Name, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverState returns the server state or an empty string
+func serverState(server *api.ServerDetail) string {
+	if server.State == nil {
+		return ""
+	}
+	return *server.State
+}
+
+// serverDrpSelectorValue classifies the server DRP as enabled, disabled or error,
+// using the same rules as the DRP column of 'server list'
+func serverDrpSelectorValue(server *api.ServerDetail) string {
+	drp := server.Drp
+	if drp == nil || !drp.Enabled {
+		return DrpSelectorDisabled
+	}
+	if drp.Status == api.DrpStatusSplitBrain || drp.SplitBrain ||
+		(drp.Status == api.DrpStatusOff && (drp.RequiresAttention || drp.LastError != "")) {
+		return DrpSelectorError
+	}
+	return DrpSelectorEnabled
+}
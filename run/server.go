@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"titan-sc/api"
 
@@ -64,17 +65,31 @@ func (run *RunMiddleware) ServerList(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
 
+	selector, err := serverListSelector(cmd)
+	if err != nil {
+		run.OutputError(err)
+		return
+	}
+
 	companyOID, err := run.GetDefaultCompanyOID(cmd)
 	if err != nil {
 		run.OutputError(err)
 		return
 	}
 
-	servers, apiReturn, err := run.API.ServerList(companyOID)
+	// The state filter is the only one supported by the API, others are applied locally
+	states := api.ServerActiveStates
+	if len(selector.States) > 0 {
+		states = selector.States
+	} else if includeDeleted, _ := cmd.Flags().GetBool("include-deleted"); includeDeleted {
+		states = append(append([]string{}, states...), StateDeleted)
+	}
+	servers, apiReturn, err := run.API.ServerListByStates(companyOID, states)
 	if err != nil || apiReturn != nil {
 		run.handleErrorAndGenericOutput(apiReturn, err)
 		return
 	}
+	servers = selector.Filter(servers)
 
 	if run.JSONOutput {
 		// Transform internal site names to public names in JSON output
@@ -125,6 +140,29 @@ func (run *RunMiddleware) ServerList(cmd *cobra.Command, args []string) {
 	}
 }
 
+// serverListSelector builds the 'server list' filters from its flags
+func serverListSelector(cmd *cobra.Command) (*ServerSelector, error) {
+	selector := &ServerSelector{}
+	for _, key := range []string{SelectorState, SelectorPlan, SelectorOS, SelectorSite, SelectorTag, SelectorDrp, SelectorHypervisor} {
+		values, _ := cmd.Flags().GetStringSlice(key)
+		if err := selector.Add(key, values...); err != nil {
+			return nil, err
+		}
+	}
+	for i, state := range selector.States {
+		selector.States[i] = strings.ToLower(state)
+	}
+
+	if name, _ := cmd.Flags().GetString("name"); name != "" {
+		nameRegexp, err := regexp.Compile(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --name regular expression: %w", err)
+		}
+		selector.NameRegexp = nameRegexp
+	}
+	return selector, nil
+}
+
 func (run *RunMiddleware) ServerDetail(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
@@ -344,33 +382,70 @@ func (run *RunMiddleware) printServerDetail(server *api.ServerDetail) {
 func (run *RunMiddleware) ServerStart(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
-	serverOID, _ := cmd.Flags().GetString("server-oid")
-	apiReturn, err := run.API.ServerStateAction("start", serverOID)
-	run.handleErrorAndGenericOutput(apiReturn, err)
+	run.serverStateAction(cmd, "start", StateStarted, false)
 }
 
 func (run *RunMiddleware) ServerStop(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
-	serverOID, _ := cmd.Flags().GetString("server-oid")
-	apiReturn, err := run.API.ServerStateAction("stop", serverOID)
-	run.handleErrorAndGenericOutput(apiReturn, err)
+	run.serverStateAction(cmd, "stop", StateStopped, false)
 }
 
 func (run *RunMiddleware) ServerRestart(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
-	serverOID, _ := cmd.Flags().GetString("server-oid")
-	apiReturn, err := run.API.ServerStateAction("reboot", serverOID)
-	run.handleErrorAndGenericOutput(apiReturn, err)
+	run.serverStateAction(cmd, "reboot", StateStarted, true)
 }
 
 func (run *RunMiddleware) ServerHardstop(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
-	serverOID, _ := cmd.Flags().GetString("server-oid")
-	apiReturn, err := run.API.ServerStateAction("hardstop", serverOID)
-	run.handleErrorAndGenericOutput(apiReturn, err)
+	run.serverStateAction(cmd, "hardstop", StateStopped, false)
+}
+
+// serverStateAction sends a state action (start, stop, reboot, hardstop) to the targeted
+// server(s). With --wait, it then blocks until the server reaches targetState.
+// Several --server-oid, --all or --selector switch to a bulk operation.
+func (run *RunMiddleware) serverStateAction(cmd *cobra.Command, action, targetState string, expectTransition bool) {
+	if isBulkRequest(cmd) {
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		run.runBulkOperation(cmd, action, func(server *api.ServerDetail) error {
+			apiReturn, err := run.API.ServerStateAction(action, server.OID)
+			if err != nil {
+				return err
+			}
+			if apiReturn != nil && apiReturn.Error() {
+				return apiReturn.AsError()
+			}
+			if wait {
+				_, err = run.waitServerState(server.OID, targetState, timeout, expectTransition)
+			}
+			return err
+		})
+		return
+	}
+
+	serverOIDs, _ := cmd.Flags().GetStringSlice("server-oid")
+	if len(serverOIDs) == 0 {
+		run.OutputError(errors.New("missing server: use --server-oid, --all or --selector"))
+		return
+	}
+	serverOID := serverOIDs[0]
+	apiReturn, err := run.API.ServerStateAction(action, serverOID)
+	if err != nil || apiReturn.Error() {
+		run.handleErrorAndGenericOutput(apiReturn, err)
+		return
+	}
+	var result interface{}
+	if apiReturn != nil {
+		result = apiReturn
+	}
+	run.reportActionAndWait(cmd, serverOID, result, func() {
+		if apiReturn != nil {
+			run.printAPIReturnAsString(apiReturn)
+		}
+	}, targetState, expectTransition)
 }
 
 func (run *RunMiddleware) ServerISOMount(cmd *cobra.Command, args []string) {
@@ -500,8 +575,17 @@ func (run *RunMiddleware) ServerReset(cmd *cobra.Command, args []string) {
 
 	serverOID, _ := cmd.Flags().GetString("server-oid")
 	sshKeys, _ := cmd.Flags().GetString("ssh-keys-name")
+	sshKeys = normalizeSSHKeyNames(sshKeys)
 	reset.TemplateOID, _ = cmd.Flags().GetString("template-oid")
-	reset.UserPassword, _ = cmd.Flags().GetString("password")
+	reset.UserPassword, err = run.loginPassword(cmd, sshKeys, reset.TemplateOID)
+	if err != nil {
+		run.OutputError(err)
+		return
+	}
+	if err = run.preflightServerReset(serverOID, reset.TemplateOID, sshKeys); err != nil {
+		run.OutputError(err)
+		return
+	}
 
 	reset.UserSSHKeys, err = run.serverSearchSSHKeys(sshKeys)
 	if err != nil {
@@ -514,15 +598,14 @@ func (run *RunMiddleware) ServerReset(cmd *cobra.Command, args []string) {
 		run.OutputError(err)
 		return
 	}
-	if apiReturn != nil {
+	if apiReturn != nil && apiReturn.Error() {
 		run.printAPIReturn(apiReturn)
 		return
 	}
-	if run.JSONOutput {
-		printAsJson(map[string]string{"success": fmt.Sprintf("Server reset initiated for %s", serverOID)})
-	} else {
-		fmt.Printf("%s Server reset initiated for %s\n", run.Colorize("Success:", "green"), serverOID)
-	}
+	message := fmt.Sprintf("Server reset initiated for %s", serverOID)
+	run.reportActionAndWait(cmd, serverOID, map[string]string{"success": message}, func() {
+		fmt.Printf("%s %s\n", run.Colorize("Success:", "green"), message)
+	}, StateStarted, true)
 }
 
 func (run *RunMiddleware) serverSearchSSHKeys(sshKeysName string) ([]string, error) {
@@ -542,7 +625,7 @@ func (run *RunMiddleware) serverSearchSSHKeys(sshKeysName string) ([]string, err
 	}
 
 	sshKeys := make([]string, 0)
-	for _, keyRequest := range strings.Split(strings.TrimSpace(sshKeysName), ",") {
+	for _, keyRequest := range sshKeyNames(sshKeysName) {
 		found := false
 		for _, keyExist := range sshKeysList {
 			if keyExist.Name == keyRequest {
@@ -567,24 +650,31 @@ type ServerCreateResult struct {
 }
 
 func (run *RunMiddleware) ServerCreate(cmd *cobra.Command, _ []string) {
-	info := CreateServerInfo{}
-
-	err := info.parse(cmd)
-	if err != nil {
-		run.OutputError(err)
+	run.ParseGlobalFlags(cmd)
+	if file, _ := cmd.Flags().GetString("file"); file != "" {
+		run.ServerCreateFromSpec(cmd)
 		return
 	}
 
+	// The plan and resources are validated with the rest by the preflight below
+	info := CreateServerInfo{}
+	info.parse(cmd)
+
 	paymentMethodOID, _ := cmd.Flags().GetString("payment-method")
 	confirmPayment, _ := cmd.Flags().GetBool("confirm-payment")
+	quoteOnly := isQuoteOnly(cmd)
 
-	if !confirmPayment {
-		run.OutputError(errors.New("payment not confirmed: add --confirm-payment flag to proceed"))
-		return
+	var err error
+	if quoteOnly {
+		info.password, err = run.passwordFlag(cmd)
+	} else if !confirmPayment {
+		err = errors.New("payment not confirmed: add --confirm-payment flag to proceed")
+	} else {
+		info.password, err = run.loginPassword(cmd, info.sshKeysName, info.templateOID)
 	}
-
-	cart := &api.AddServerCart{
-		Quantity: info.quantity,
+	if err != nil {
+		run.OutputError(err)
+		return
 	}
 
 	user, err := run.API.GetUserInfos()
@@ -592,60 +682,60 @@ func (run *RunMiddleware) ServerCreate(cmd *cobra.Command, _ []string) {
 		run.OutputError(err)
 		return
 	}
-	cart.CartOID = user.OID
+	if err = run.preflightServerCreate(cmd, &info, user.DefaultCompanyOID); err != nil {
+		run.OutputError(err)
+		return
+	}
 
-	// Use default payment method if not specified
-	if paymentMethodOID == "" {
-		company, err := run.API.GetCompanyDetails(user.DefaultCompanyOID)
+	if quoteOnly {
+		quote, err := run.quoteServer(&info)
 		if err != nil {
 			run.OutputError(err)
 			return
 		}
-		if company.DefaultPaymentMethod != nil {
-			paymentMethodOID = *company.DefaultPaymentMethod
+		if run.JSONOutput {
+			printAsJson(quote)
+		} else {
+			run.printServerQuote(quote)
 		}
-	}
-
-	if err = run.setServerItems(cart, &info); err != nil {
-		run.OutputError(err)
 		return
 	}
 
-	if info.template.Type != OSTypeWindows {
-		if err = run.setServerAuth(cart, info.password, info.sshKeysName); err != nil {
+	// Use default payment method if not specified
+	if paymentMethodOID == "" {
+		if paymentMethodOID, err = run.defaultPaymentMethod(user.DefaultCompanyOID); err != nil {
 			run.OutputError(err)
 			return
 		}
 	}
 
-	cartOID, err := run.API.CreateServerCart(cart)
+	cartOID, err := run.createServerCart(&info)
 	if err != nil {
 		run.OutputError(err)
 		return
 	}
 
-	// Get price preview
-	price, err := run.API.GetCartPrice(cartOID)
-	if err != nil {
-		run.OutputError(err)
-		return
-	}
-
-	priceHT := float64(price.Amount.HT) / 100
-	priceTTC := float64(price.Amount.TTC) / 100
-
 	if !run.JSONOutput {
 		fmt.Printf("Cart created: %s\n", cartOID)
-		fmt.Printf("Price: %.2f€ TTC (%.2f€ HT)\n", priceTTC, priceHT)
-		fmt.Println("Processing payment...")
 	}
 
 	subscriptionOID, _ := cmd.Flags().GetString("subscription-oid")
-
-	if err = run.API.BuyCart(cartOID, paymentMethodOID, subscriptionOID); err != nil {
+	overrideBudget, _ := cmd.Flags().GetBool("override-budget")
+
+	price, err := run.buyCart(&cartPurchase{
+		command:          cmd.CommandPath(),
+		cartOID:          cartOID,
+		paymentMethodOID: paymentMethodOID,
+		subscriptionOID:  subscriptionOID,
+		servers:          info.quantity,
+		overrideBudget:   overrideBudget,
+	})
+	if err != nil {
 		run.OutputError(err)
 		return
 	}
+	priceHT := float64(price.HT) / 100
+	priceTTC := float64(price.TTC) / 100
 
 	if !run.JSONOutput {
 		fmt.Println("Server order completed successfully.")
@@ -660,6 +750,13 @@ func (run *RunMiddleware) ServerCreate(cmd *cobra.Command, _ []string) {
 	}
 }
 
+// isQuoteOnly tells if 'server create' only prices the order (--dry-run or --quote)
+func isQuoteOnly(cmd *cobra.Command) bool {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	quote, _ := cmd.Flags().GetBool("quote")
+	return dryRun || quote
+}
+
 // Plan minimum resources (disk is in GB, internally divided by 10 for API)
 var planMinResources = map[string]struct{ cpu, ram, diskGB int }{
 	SC1: {1, 1, 10},
@@ -667,39 +764,99 @@ var planMinResources = map[string]struct{ cpu, ram, diskGB int }{
 	SC3: {6, 8, 100},
 }
 
-func (a *CreateServerInfo) parse(cmd *cobra.Command) error {
+// resources returns the CPU cores, GB of RAM and GB of disk of the server to order,
+// the plan minimums when not set
+func (a *CreateServerInfo) resources() (cpu, ram, disk int) {
+	min := planMinResources[strings.ToUpper(a.plan)]
+	cpu, ram, disk = a.cpu, a.ram, a.disk
+	if cpu == 0 {
+		cpu = min.cpu
+	}
+	if ram == 0 {
+		ram = min.ram
+	}
+	if disk == 0 {
+		disk = min.diskGB
+	}
+	return cpu, ram, disk
+}
+
+// parse reads the server flags, to be checked with validate
+func (a *CreateServerInfo) parse(cmd *cobra.Command) {
 	a.plan, _ = cmd.Flags().GetString("plan")
 	a.templateOID, _ = cmd.Flags().GetString("template-oid")
-	a.password, _ = cmd.Flags().GetString("password")
-	a.sshKeysName, _ = cmd.Flags().GetString("ssh-keys-name")
+	sshKeysName, _ := cmd.Flags().GetString("ssh-keys-name")
+	a.sshKeysName = normalizeSSHKeyNames(sshKeysName)
 	a.quantity, _ = cmd.Flags().GetInt("quantity")
 	a.cpu, _ = cmd.Flags().GetInt("cpu")
 	a.ram, _ = cmd.Flags().GetInt("ram")
 	a.disk, _ = cmd.Flags().GetInt("disk")
+}
 
+// validate checks the plan and the minimum resources of the plan, and returns
+// every problem found
+func (a *CreateServerInfo) validate() []error {
 	a.plan = strings.ToUpper(a.plan)
 	if a.plan != SC1 && a.plan != SC2 && a.plan != SC3 {
-		return ErrCreateServerPlanInvalid
+		return []error{ErrCreateServerPlanInvalid}
 	}
 
 	// Validate minimum resources for plan
+	var errs []error
 	min := planMinResources[a.plan]
 	if a.cpu > 0 && a.cpu < min.cpu {
-		return fmt.Errorf("plan %s requires minimum %d CPU(s), got %d", a.plan, min.cpu, a.cpu)
+		errs = append(errs, fmt.Errorf("plan %s requires minimum %d CPU(s), got %d", a.plan, min.cpu, a.cpu))
 	}
 	if a.ram > 0 && a.ram < min.ram {
-		return fmt.Errorf("plan %s requires minimum %d GB RAM, got %d", a.plan, min.ram, a.ram)
+		errs = append(errs, fmt.Errorf("plan %s requires minimum %d GB RAM, got %d", a.plan, min.ram, a.ram))
 	}
 	if a.disk > 0 {
 		if a.disk%10 != 0 {
-			return fmt.Errorf("disk must be a multiple of 10 GB, got %d", a.disk)
+			errs = append(errs, fmt.Errorf("disk must be a multiple of 10 GB, got %d", a.disk))
 		}
 		if a.disk < min.diskGB {
-			return fmt.Errorf("plan %s requires minimum %d GB disk, got %d", a.plan, min.diskGB, a.disk)
+			errs = append(errs, fmt.Errorf("plan %s requires minimum %d GB disk, got %d", a.plan, min.diskGB, a.disk))
 		}
 	}
+	return errs
+}
 
-	return nil
+// createServerCart creates a new cart ordering the servers described by info, so that
+// nothing left in another cart is bought with them
+func (run *RunMiddleware) createServerCart(info *CreateServerInfo) (string, error) {
+	cart, err := run.buildServerCart(info)
+	if err != nil {
+		return "", err
+	}
+	return run.API.CreateServerCart(cart)
+}
+
+// buildServerCart returns the items and authentication of the servers described by info
+func (run *RunMiddleware) buildServerCart(info *CreateServerInfo) (*api.AddServerCart, error) {
+	cart := &api.AddServerCart{Quantity: info.quantity}
+
+	if err := run.setServerItems(cart, info); err != nil {
+		return nil, err
+	}
+
+	if info.template.Type != OSTypeWindows {
+		if err := run.setServerAuth(cart, info.password, info.sshKeysName); err != nil {
+			return nil, err
+		}
+	}
+	return cart, nil
+}
+
+// defaultPaymentMethod returns the default payment method of a company, if any
+func (run *RunMiddleware) defaultPaymentMethod(companyOID string) (string, error) {
+	company, err := run.API.GetCompanyDetails(companyOID)
+	if err != nil {
+		return "", err
+	}
+	if company.DefaultPaymentMethod != nil {
+		return *company.DefaultPaymentMethod, nil
+	}
+	return "", nil
 }
 
 func (run *RunMiddleware) setServerAuth(cart *api.AddServerCart, password, sshKeysName string) error {
@@ -864,7 +1021,7 @@ func (run *RunMiddleware) getSSHKeysValue(sshKeysName string) ([]string, error)
 		return nil, err
 	}
 
-	for _, name := range strings.Split(sshKeysName, ",") {
+	for _, name := range sshKeyNames(sshKeysName) {
 		find := false
 		for _, sshKey := range sshKeysList {
 			if sshKey.Name == name {
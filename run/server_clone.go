@@ -0,0 +1,191 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// ServerCloneResult is returned as JSON by 'server clone'
+type ServerCloneResult struct {
+	ServerSpecResult
+	From  string       `json:"from"`
+	Login string       `json:"login,omitempty"`
+	Spec  ServerSpec   `json:"spec"`
+	Quote *ServerQuote `json:"quote"`
+}
+
+// ServerClone orders a server like an existing one: same plan, template, CPU, RAM,
+// disk and private networks. The order is quoted and confirmed before it is bought,
+// then the new server is named and attached to the networks of the source.
+func (run *RunMiddleware) ServerClone(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	from, _ := cmd.Flags().GetString("from")
+	name, _ := cmd.Flags().GetString("name")
+	sshKeysName, _ := cmd.Flags().GetString("ssh-keys-name")
+	sshKeysName = normalizeSSHKeyNames(sshKeysName)
+	confirmPayment, _ := cmd.Flags().GetBool("confirm-payment")
+
+	if !isQuoteOnly(cmd) && !confirmPayment {
+		run.OutputErrorAndExit(errors.New("payment not confirmed: add --confirm-payment flag to proceed"))
+	}
+
+	source, err := run.resolveServer(cmd, from)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	spec, err := run.cloneServerSpec(companyOID, source.OID, name, sshKeysName)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	var password string
+	if isQuoteOnly(cmd) {
+		password, err = run.passwordFlag(cmd)
+	} else {
+		password, err = run.loginPassword(cmd, sshKeysName, spec.TemplateOID)
+	}
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	p := &serverPreflight{run: run}
+	if !isQuoteOnly(cmd) {
+		run.preflightPayment(cmd, p, companyOID)
+	}
+	orders, err := run.validateServerSpecs(p, companyOID, []ServerSpec{*spec}, password)
+	if err == nil {
+		err = p.err(fmt.Sprintf("cannot clone server %s", source.Name))
+	}
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	result := &ServerCloneResult{
+		ServerSpecResult: ServerSpecResult{Name: name, IPs: []string{}, Networks: []string{}},
+		From:             source.Name,
+		Spec:             *spec,
+	}
+	if result.Quote, err = run.quoteServer(&orders[0].info); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	result.Quote.Name = name
+	if isQuoteOnly(cmd) {
+		if run.JSONOutput {
+			printAsJson(result)
+		} else {
+			run.printServerClone(result)
+		}
+		return
+	}
+
+	if !run.JSONOutput {
+		run.printServerClone(result)
+	}
+	question := fmt.Sprintf("Buy server %s, a clone of %s, for %s TTC?", name, source.Name, formatMoney(result.Quote.TTC, result.Quote.Currency))
+	if err = run.confirmAction(cmd, question); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	order, err := run.newServerOrder(cmd, companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	delivery, err := order.buyServer(&orders[0].info)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	result.OID = delivery.oid
+	if !run.JSONOutput {
+		fmt.Printf("Server %s ordered, waiting for it to start...\n", result.OID)
+	}
+	if err = run.setupSpecServer(companyOID, &orders[0], &result.ServerSpecResult, delivery.deadline); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+	if server, apiReturn, err := run.API.GetServerOID(result.OID); apiCallError(apiReturn, err) == nil && server.Authentication != nil {
+		result.Login = server.Authentication.UserLogin
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+	} else {
+		failed := 0
+		if !result.Success {
+			failed = 1
+		}
+		run.printServerSpecResults([]ServerSpecResult{result.ServerSpecResult}, failed)
+		if source.Authentication != nil && result.Login != "" && result.Login != source.Authentication.UserLogin {
+			fmt.Printf("%s login of %s is %s, %s uses %s\n", run.Colorize("Warning:", "yellow"),
+				name, result.Login, source.Name, source.Authentication.UserLogin)
+		}
+	}
+	if !result.Success {
+		os.Exit(1)
+	}
+}
+
+// cloneServerSpec returns the spec of a server like the source one. SSH keys cannot
+// be read from a server, so they are given by the caller.
+func (run *RunMiddleware) cloneServerSpec(companyOID, sourceOID, name, sshKeysName string) (*ServerSpec, error) {
+	source, apiReturn, err := run.API.GetServerOID(sourceOID)
+	if err = apiCallError(apiReturn, err); err != nil {
+		return nil, err
+	}
+	spec := &ServerSpec{Name: name, Plan: strings.ToUpper(source.Items.CPU.Plan)}
+	if template := source.Items.OS.Template; template != nil {
+		spec.TemplateOID = template.OID
+	}
+	if spec.TemplateOID == "" {
+		return nil, fmt.Errorf("template of server %s not found", source.Name)
+	}
+	spec.CPU, spec.RAM, spec.Disk = serverResources(source)
+	spec.SSHKeys = sshKeyNames(sshKeysName)
+
+	networks, err := run.API.GetNetworkList(companyOID)
+	if err != nil {
+		return nil, err
+	}
+	// Networks are named in the spec, unless several networks share the name
+	names := map[string]int{}
+	for _, network := range networks.Networks {
+		names[network.Name]++
+	}
+	for _, network := range networks.Networks {
+		if !isNetworkMember(&network, source.OID) {
+			continue
+		}
+		if names[network.Name] == 1 {
+			spec.Networks = append(spec.Networks, network.Name)
+		} else {
+			spec.Networks = append(spec.Networks, network.OID)
+		}
+	}
+	return spec, nil
+}
+
+func isNetworkMember(network *api.NetworkDetail, serverOID string) bool {
+	for _, iface := range network.Interfaces {
+		if iface.Server.OID == serverOID {
+			return true
+		}
+	}
+	return false
+}
+
+func (run *RunMiddleware) printServerClone(result *ServerCloneResult) {
+	networks := "none"
+	if len(result.Spec.Networks) > 0 {
+		networks = strings.Join(result.Spec.Networks, ", ")
+	}
+	fmt.Printf("Clone of %s as %s, networks: %s\n", result.From, result.Name, networks)
+	run.printServerQuote(result.Quote)
+}
@@ -0,0 +1,233 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// DefaultExecParallelism is the number of servers 'server exec' runs the command on at once
+	DefaultExecParallelism = 10
+	// DefaultExecTimeout is the maximum duration of the command on each server
+	DefaultExecTimeout = 60 * time.Second
+)
+
+// ExecResult is the outcome of a remote command on a single server
+type ExecResult struct {
+	ServerOID string `json:"server_oid"`
+	Name      string `json:"name"`
+	Address   string `json:"address,omitempty"`
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Error     string `json:"error,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// ServerExec runs a command over SSH on several servers in parallel.
+// Servers are targeted and confirmed like bulk operations (--server-oid, --all, --selector, --yes).
+// Output lines are prefixed with the server name, or collected per server in JSON mode.
+// Exits with a non-zero status if the command failed on any server.
+func (run *RunMiddleware) ServerExec(cmd *cobra.Command, args []string) {
+	run.ParseGlobalFlags(cmd)
+
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 || dash >= len(args) {
+		run.OutputErrorAndExit(errors.New("missing command: give it after --, e.g. 'server exec --all -- uptime'"))
+	}
+	if dash > 0 {
+		run.OutputErrorAndExit(fmt.Errorf("unexpected arguments before --: %s", strings.Join(args[:dash], " ")))
+	}
+	command := args[dash:]
+
+	ipv6, _ := cmd.Flags().GetBool("ipv6")
+	user, _ := cmd.Flags().GetString("user")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	opts := sshOptionsFromFlags(cmd)
+	// Never wait for a password or a host key confirmation, unless BatchMode is set:
+	// ssh keeps the first value of an option
+	if !opts.hasOption("BatchMode") {
+		opts.Options = append([]string{"BatchMode=yes"}, opts.Options...)
+	}
+
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil {
+		run.OutputErrorAndExit(fmt.Errorf("ssh client not found: %w", err))
+	}
+
+	servers, err := run.ResolveServerTargets(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if len(servers) == 0 {
+		run.OutputErrorAndExit(errors.New("no server matches the given criteria"))
+	}
+	if isBulkRequest(cmd) {
+		if err = run.confirmBulkOperation(cmd, "exec "+strings.Join(command, " "), servers); err != nil {
+			run.OutputErrorAndExit(err)
+		}
+	}
+	if err = run.completeServerDetails(servers); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	results := make(map[string]*ExecResult, len(servers))
+	for _, server := range servers {
+		results[server.OID] = &ExecResult{ServerOID: server.OID, Name: server.Name}
+	}
+	var outputMutex sync.Mutex
+	runBulk(servers, parallel, func(server *api.ServerDetail) error {
+		result := results[server.OID]
+		target, err := serverSSHTarget(server, ipv6)
+		if err != nil {
+			result.ExitCode = -1
+			result.Error = err.Error()
+			run.printExecError(&outputMutex, result)
+			return err
+		}
+		if user != "" {
+			target.User = user
+		}
+		result.Address = target.Address
+		run.execOnTarget(sshPath, target, opts, command, timeout, result, &outputMutex)
+		return nil
+	})
+
+	failed := 0
+	ordered := make([]ExecResult, 0, len(servers))
+	for _, server := range servers {
+		result := results[server.OID]
+		if result.ExitCode != 0 || result.Error != "" {
+			failed++
+		}
+		ordered = append(ordered, *result)
+	}
+
+	if run.JSONOutput {
+		printAsJson(ordered)
+	} else if failed > 0 {
+		fmt.Printf("%s command failed on %d/%d server(s)\n", run.Colorize("Error:", "red"), failed, len(ordered))
+	} else {
+		fmt.Printf("%s command succeeded on %d server(s)\n", run.Colorize("Success:", "green"), len(ordered))
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// execOnTarget runs command on the target with ssh and fills result.
+// Outside of JSON mode, output lines are printed as they come, prefixed by the server name.
+func (run *RunMiddleware) execOnTarget(sshPath string, target *SSHTarget, opts SSHOptions, command []string,
+	timeout time.Duration, result *ExecResult, outputMutex *sync.Mutex) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	var writers []*prefixWriter
+	sshCmd := exec.CommandContext(ctx, sshPath, target.SSHArgs(opts, command)...)
+	// Do not hang on output pipes kept open by children of a killed ssh
+	sshCmd.WaitDelay = time.Second
+	if run.JSONOutput {
+		sshCmd.Stdout = &stdout
+		sshCmd.Stderr = &stderr
+	} else {
+		prefix := run.Colorize(target.Name, "cyan") + " | "
+		stdoutWriter := &prefixWriter{prefix: prefix, out: os.Stdout, mutex: outputMutex}
+		stderrWriter := &prefixWriter{prefix: prefix, out: os.Stderr, mutex: outputMutex}
+		writers = append(writers, stdoutWriter, stderrWriter)
+		sshCmd.Stdout = io.MultiWriter(&stdout, stdoutWriter)
+		sshCmd.Stderr = io.MultiWriter(&stderr, stderrWriter)
+	}
+
+	start := time.Now()
+	err := sshCmd.Run()
+	for _, writer := range writers {
+		writer.Flush()
+	}
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("timeout after %s", timeout)
+		run.printExecError(outputMutex, result)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		if result.ExitCode == 255 {
+			// ssh itself failed (connection, authentication)
+			result.Error = "ssh exited with status 255 (connection or authentication failure)"
+			run.printExecError(outputMutex, result)
+		} else if !run.JSONOutput {
+			outputMutex.Lock()
+			fmt.Fprintf(os.Stderr, "%s | %s\n", run.Colorize(target.Name, "cyan"),
+				run.Colorize(fmt.Sprintf("exit status %d", result.ExitCode), "red"))
+			outputMutex.Unlock()
+		}
+	case err != nil:
+		result.ExitCode = -1
+		result.Error = err.Error()
+		run.printExecError(outputMutex, result)
+	}
+}
+
+// printExecError reports a server that could not run the command (human output only)
+func (run *RunMiddleware) printExecError(outputMutex *sync.Mutex, result *ExecResult) {
+	if run.JSONOutput {
+		return
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintf(os.Stderr, "%s | %s %s\n", run.Colorize(result.Name, "cyan"), run.Colorize("Error:", "red"), result.Error)
+}
+
+// prefixWriter writes complete lines prefixed with prefix, holding mutex so that
+// lines from concurrent commands are not interleaved
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mutex  *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line if it does not end with a newline
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, _ = io.WriteString(w.out, w.prefix)
+	_, _ = w.out.Write(line)
+}
@@ -0,0 +1,327 @@
+package run
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultProvisionTimeout is how long we wait for ordered servers to be delivered and started
+const DefaultProvisionTimeout = 20 * time.Minute
+
+// serverOIDSet returns the OIDs of the company servers, used to spot the servers
+// delivered by an order
+func (run *RunMiddleware) serverOIDSet(companyOID string) (map[string]bool, error) {
+	servers, apiReturn, err := run.API.ServerList(companyOID)
+	if err = apiCallError(apiReturn, err); err != nil {
+		return nil, err
+	}
+	oids := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		oids[server.OID] = true
+	}
+	return oids, nil
+}
+
+// deliveryClockSkew is the margin allowed between the local clock and the API clock
+// when checking that a server was created after it was ordered
+const deliveryClockSkew = time.Minute
+
+// serverDelivery is a server bought by an order until it is identified among the
+// company servers: the order API does not return the OIDs of the servers it creates
+type serverDelivery struct {
+	info      *CreateServerInfo
+	known     map[string]bool // Servers of the company before the order
+	orderedAt time.Time
+	deadline  time.Time
+	oid       string
+}
+
+// matches tells if server may be the delivered one: it is new since the order, was
+// created after the order started, and has the ordered plan, template and resources
+func (d *serverDelivery) matches(server *api.ServerDetail) bool {
+	if d.known[server.OID] {
+		return false
+	}
+	if server.CreatedAt != nil && millisecondsToTime(*server.CreatedAt).Before(d.orderedAt.Add(-deliveryClockSkew)) {
+		return false
+	}
+	if !strings.EqualFold(server.Items.CPU.Plan, d.info.plan) {
+		return false
+	}
+	if template := server.Items.OS.Template; template == nil || template.OID != d.info.templateOID {
+		return false
+	}
+	cpu, ram, disk := serverResources(server)
+	wantCPU, wantRAM, wantDisk := d.info.resources()
+	return cpu == wantCPU && ram == wantRAM && disk == wantDisk
+}
+
+// alike tells if two deliveries are for the same kind of server, so that one cannot
+// tell their servers apart
+func (d *serverDelivery) alike(other *serverDelivery) bool {
+	cpu, ram, disk := d.info.resources()
+	otherCPU, otherRAM, otherDisk := other.info.resources()
+	return strings.EqualFold(d.info.plan, other.info.plan) && d.info.templateOID == other.info.templateOID &&
+		cpu == otherCPU && ram == otherRAM && disk == otherDisk
+}
+
+// identifyDeliveries polls the company servers with backoff until the server of each
+// delivery is identified, or its deadline is reached, and returns the error of each
+// delivery. A server is only taken when it cannot be someone else's: if more new
+// servers match a delivery than were ordered alike, another order is running for the
+// company and the delivery fails, so that a server nobody can identify is never set up.
+func (run *RunMiddleware) identifyDeliveries(companyOID string, deliveries []*serverDelivery) []error {
+	errs := make([]error, len(deliveries))
+	delay := waitInitialDelay
+	for {
+		servers, apiReturn, err := run.API.ServerList(companyOID)
+		if err = apiCallError(apiReturn, err); err != nil {
+			for i, d := range deliveries {
+				if d.oid == "" && errs[i] == nil {
+					errs[i] = err
+				}
+			}
+			return errs
+		}
+		sort.SliceStable(servers, func(i, j int) bool {
+			return serverCreatedAt(&servers[i]) < serverCreatedAt(&servers[j])
+		})
+
+		claimed := map[string]bool{}
+		var pending []*serverDelivery
+		for i, d := range deliveries {
+			if d.oid != "" {
+				claimed[d.oid] = true
+			} else if errs[i] == nil {
+				pending = append(pending, d)
+			}
+		}
+		for i, d := range deliveries {
+			if d.oid != "" || errs[i] != nil {
+				continue
+			}
+			var candidates []string
+			for j := range servers {
+				if !claimed[servers[j].OID] && d.matches(&servers[j]) {
+					candidates = append(candidates, servers[j].OID)
+				}
+			}
+			alike := 0
+			for _, other := range pending {
+				if other.oid == "" && d.alike(other) {
+					alike++
+				}
+			}
+			switch {
+			case len(candidates) > alike:
+				errs[i] = fmt.Errorf("bought, but %d new servers match it (%s): another order is running, identify yours and set it up by hand",
+					len(candidates), strings.Join(candidates, ", "))
+			case len(candidates) > 0:
+				d.oid = candidates[0]
+				claimed[d.oid] = true
+			case time.Now().After(d.deadline):
+				errs[i] = fmt.Errorf("bought, not yet delivered after %s", d.deadline.Sub(d.orderedAt).Round(time.Second))
+			}
+		}
+
+		next := time.Time{}
+		for i, d := range deliveries {
+			if d.oid == "" && errs[i] == nil && (next.IsZero() || d.deadline.Before(next)) {
+				next = d.deadline
+			}
+		}
+		if next.IsZero() {
+			return errs
+		}
+		if wait := time.Until(next); wait < delay {
+			// Poll once more at the deadline
+			delay = wait
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		delay = delay * 3 / 2
+		if delay < waitInitialDelay {
+			delay = waitInitialDelay
+		}
+		if delay > waitMaxDelay {
+			delay = waitMaxDelay
+		}
+	}
+}
+
+func serverCreatedAt(server *api.ServerDetail) int64 {
+	if server.CreatedAt == nil {
+		return 0
+	}
+	return *server.CreatedAt
+}
+
+// serverOrder holds what is needed to order servers for a company. The servers
+// it orders count together against the budget.
+type serverOrder struct {
+	run              *RunMiddleware
+	command          string
+	companyOID       string
+	paymentMethodOID string
+	subscriptionOID  string
+	overrideBudget   bool
+	timeout          time.Duration
+
+	ordered int
+	spent   int64
+}
+
+// newServerOrder returns an order for a company, paid with --payment-method (or the
+// default payment method of the company) and bounded by --timeout
+func (run *RunMiddleware) newServerOrder(cmd *cobra.Command, companyOID string) (*serverOrder, error) {
+	order := &serverOrder{run: run, command: cmd.CommandPath(), companyOID: companyOID}
+	order.overrideBudget, _ = cmd.Flags().GetBool("override-budget")
+	order.paymentMethodOID, _ = cmd.Flags().GetString("payment-method")
+	order.subscriptionOID, _ = cmd.Flags().GetString("subscription-oid")
+	order.timeout, _ = cmd.Flags().GetDuration("timeout")
+	if order.paymentMethodOID == "" {
+		var err error
+		if order.paymentMethodOID, err = run.defaultPaymentMethod(companyOID); err != nil {
+			return nil, err
+		}
+	}
+	if order.timeout <= 0 {
+		order.timeout = DefaultProvisionTimeout
+	}
+	return order, nil
+}
+
+// checkBudget quotes the servers about to be ordered and checks their total against
+// the budget of the profile, before the first of them is bought
+func (o *serverOrder) checkBudget(infos []*CreateServerInfo) error {
+	var ht, ttc int64
+	for _, info := range infos {
+		quote, err := o.run.quoteServer(info)
+		if err != nil {
+			return err
+		}
+		ht += quote.HT
+		ttc += quote.TTC
+	}
+	if !o.run.JSONOutput {
+		fmt.Printf("Total: %s TTC (%s HT) for %d server(s)\n", formatMoney(ttc, DefaultCurrency), formatMoney(ht, DefaultCurrency), len(infos))
+	}
+	return o.run.checkBudget(o.command, len(infos), ht, ttc, o.overrideBudget)
+}
+
+// buy orders a server and returns its delivery, to be identified once the server
+// shows up in the company
+func (o *serverOrder) buy(info *CreateServerInfo) (*serverDelivery, error) {
+	known, err := o.run.serverOIDSet(o.companyOID)
+	if err != nil {
+		return nil, err
+	}
+	cartOID, err := o.run.createServerCart(info)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &serverDelivery{info: info, known: known, orderedAt: time.Now()}
+	delivery.deadline = delivery.orderedAt.Add(o.timeout)
+	price, err := o.run.buyCart(&cartPurchase{
+		command:          o.command,
+		cartOID:          cartOID,
+		paymentMethodOID: o.paymentMethodOID,
+		subscriptionOID:  o.subscriptionOID,
+		servers:          1,
+		overrideBudget:   o.overrideBudget,
+		previousServers:  o.ordered,
+		previousTTC:      o.spent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.ordered++
+	o.spent += price.TTC
+	return delivery, nil
+}
+
+// buyServer orders a server and returns its delivery as soon as the server is
+// identified in the company
+func (o *serverOrder) buyServer(info *CreateServerInfo) (*serverDelivery, error) {
+	delivery, err := o.buy(info)
+	if err != nil {
+		return nil, err
+	}
+	if err = o.run.identifyDeliveries(o.companyOID, []*serverDelivery{delivery})[0]; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// waitStartedBefore waits for a delivered server to start before deadline. Unlike
+// waitServerState, which falls back to DefaultWaitTimeout, a passed deadline is a timeout.
+func (run *RunMiddleware) waitStartedBefore(serverOID string, deadline time.Time) error {
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return fmt.Errorf("%w '%s': the delivery took the whole timeout", ErrWaitTimeout, StateStarted)
+	}
+	_, err := run.waitServerState(serverOID, StateStarted, timeout, false)
+	return err
+}
+
+// orderServer orders a server, waits for it to be delivered and started, and names it
+func (o *serverOrder) orderServer(name string, info *CreateServerInfo) (string, error) {
+	delivery, err := o.buyServer(info)
+	if err != nil {
+		return "", err
+	}
+	oid := delivery.oid
+	if err = o.run.waitStartedBefore(oid, delivery.deadline); err != nil {
+		return oid, err
+	}
+	if err = apiCallError(o.run.API.ServerChangeName(name, oid)); err != nil {
+		return oid, fmt.Errorf("server %s ordered but not renamed: %w", oid, err)
+	}
+	return oid, nil
+}
+
+// templateResolver finds the template to order a server with, by OID or by OS
+// and version. The template list is fetched once.
+type templateResolver struct {
+	run       *RunMiddleware
+	templates []api.TemplateOSItem
+}
+
+func (r *templateResolver) resolve(templateOID, os, osVersion string) (*api.Template, error) {
+	if templateOID != "" {
+		return r.run.API.GetTemplateByOID(templateOID)
+	}
+	if os == "" {
+		return nil, fmt.Errorf("template_oid or os is required to order it")
+	}
+	if r.templates == nil {
+		templates, apiReturn, err := r.run.API.ListTemplates()
+		if err = apiCallError(apiReturn, err); err != nil {
+			return nil, err
+		}
+		r.templates = templates
+	}
+
+	var matches []api.Template
+	for _, group := range r.templates {
+		for _, template := range group.Versions {
+			if strings.EqualFold(template.OS, os) && (osVersion == "" || template.Version == osVersion) {
+				matches = append(matches, template)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no template for os %s", strings.TrimSpace(os+" "+osVersion))
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("several templates for os %s, set os_version or template_oid", os)
+	}
+}
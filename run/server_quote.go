@@ -0,0 +1,166 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+	"titan-sc/api"
+)
+
+// QuoteLine is a component of a server order and its price, excluding tax
+type QuoteLine struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	HT       int64  `json:"ht"` // Cents
+}
+
+// ServerQuote is the itemized price of a server order, returned as JSON by
+// 'server create --dry-run'. Amounts are in cents.
+type ServerQuote struct {
+	Name      string      `json:"name,omitempty"`
+	Plan      string      `json:"plan"`
+	Template  string      `json:"template"`
+	Quantity  int         `json:"quantity"`
+	Lines     []QuoteLine `json:"lines"`
+	Initial   int64       `json:"initial"`
+	Discount  int64       `json:"discount"`
+	HT        int64       `json:"ht"`
+	TVA       int64       `json:"tva"`
+	TTC       int64       `json:"ttc"`
+	Remaining int64       `json:"remaining"`
+	Currency  string      `json:"currency"`
+}
+
+// quoteServer prices the servers described by info without buying them. The cart
+// API only prices whole carts, so the components are priced by growing carts: the
+// plan package, then the OS, then each addon; a partial cart the API refuses is
+// merged into the next line. Each partial cart is a new one, never bought.
+func (run *RunMiddleware) quoteServer(info *CreateServerInfo) (*ServerQuote, error) {
+	cart := &api.AddServerCart{Quantity: info.quantity}
+	if err := run.setServerItems(cart, info); err != nil {
+		return nil, err
+	}
+	items, err := run.API.ListItems()
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &ServerQuote{
+		Plan:     info.plan,
+		Template: strings.TrimSpace(info.template.OS + " " + info.template.Version),
+		Quantity: info.quantity,
+		Lines:    []QuoteLine{},
+		Currency: DefaultCurrency,
+	}
+
+	// The package is the plan items and the MAC; then come the OS and the addons
+	var steps [][]api.AddServerCartItem
+	var labels []string
+	var quantities []int
+	var pkg []api.AddServerCartItem
+	for _, item := range cart.Items {
+		kind, isPackage := "", false
+		if catalogItem := findItem(item.OID, items); catalogItem != nil {
+			kind, isPackage = catalogItem.Type, catalogItem.Package
+		}
+		switch {
+		case kind == ItemTypeOS:
+			label := "OS " + quote.Template
+			if info.template.HasLicense != nil && *info.template.HasLicense {
+				label += " (license)"
+			}
+			steps, labels, quantities = append(steps, []api.AddServerCartItem{item}), append(labels, label), append(quantities, 1)
+		case isPackage || kind == ItemTypeMac:
+			pkg = append(pkg, item)
+		default:
+			label := fmt.Sprintf("%s addon", kind)
+			steps, labels, quantities = append(steps, []api.AddServerCartItem{item}), append(labels, label), append(quantities, item.Quantity)
+		}
+	}
+	steps = append([][]api.AddServerCartItem{pkg}, steps...)
+	labels = append([]string{fmt.Sprintf("Plan %s (%s)", info.plan, describeResources(&CreateServerInfo{plan: info.plan}))}, labels...)
+	quantities = append([]int{1}, quantities...)
+
+	var previous int64
+	var pending []string
+	partial := &api.AddServerCart{Quantity: cart.Quantity}
+	for i, step := range steps {
+		partial.Items = append(partial.Items, step...)
+		pending = append(pending, labels[i])
+		last := i == len(steps)-1
+
+		price, err := run.priceCart(partial)
+		if err != nil {
+			if last {
+				return nil, err
+			}
+			continue
+		}
+		quantity := quantities[i]
+		if len(pending) > 1 {
+			quantity = 1
+		}
+		quote.Lines = append(quote.Lines, QuoteLine{Item: strings.Join(pending, " + "), Quantity: quantity, HT: price.HT - previous})
+		previous, pending = price.HT, nil
+		if last {
+			quote.Initial, quote.HT, quote.TVA, quote.TTC, quote.Remaining = price.Initial, price.HT, price.TVA, price.TTC, price.Remaining
+			quote.Discount = price.Initial - price.HT
+			if quote.Discount < 0 {
+				quote.Discount = 0
+			}
+		}
+	}
+	return quote, nil
+}
+
+// priceCart puts the items in a new cart, used only to price them, and returns its price
+func (run *RunMiddleware) priceCart(cart *api.AddServerCart) (*api.CartAmount, error) {
+	cartOID, err := run.API.CreateServerCart(cart)
+	if err != nil {
+		return nil, err
+	}
+	price, err := run.API.GetCartPrice(cartOID)
+	if err != nil {
+		return nil, err
+	}
+	return &price.Amount, nil
+}
+
+// findItem returns the catalog item with the given OID, or nil
+func findItem(oid string, items []api.ItemLimited) *api.ItemLimited {
+	for i := range items {
+		if items[i].OID == oid {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+func (run *RunMiddleware) printServerQuote(quote *ServerQuote) {
+	title := fmt.Sprintf("%d x %s server, %s", quote.Quantity, quote.Plan, quote.Template)
+	if quote.Name != "" {
+		title = fmt.Sprintf("%s (%s)", quote.Name, title)
+	}
+	fmt.Printf("Quote for %s\n", run.Colorize(title, "cyan"))
+
+	table := NewTable("ITEM", "QUANTITY", "PRICE (HT)")
+	table.SetNoColor(!run.Color)
+	for _, line := range quote.Lines {
+		table.AddRow(
+			Col(line.Item),
+			ColCount(fmt.Sprintf("%d", line.Quantity)),
+			Col(formatMoney(line.HT, quote.Currency)),
+		)
+	}
+	table.Print()
+
+	if quote.Discount > 0 {
+		fmt.Printf("  %-10s %s\n", "Initial:", formatMoney(quote.Initial, quote.Currency))
+		fmt.Printf("  %-10s %s\n", "Discount:", formatMoney(-quote.Discount, quote.Currency))
+	}
+	fmt.Printf("  %-10s %s\n", "Total HT:", formatMoney(quote.HT, quote.Currency))
+	fmt.Printf("  %-10s %s\n", "VAT (TVA):", formatMoney(quote.TVA, quote.Currency))
+	fmt.Printf("  %-10s %s\n", "Total TTC:", run.Colorize(formatMoney(quote.TTC, quote.Currency), "green"))
+	if quote.Remaining != 0 && quote.Remaining != quote.TTC {
+		fmt.Printf("  %-10s %s\n", "Due now:", formatMoney(quote.Remaining, quote.Currency))
+	}
+}
@@ -0,0 +1,391 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// ServerSpecFile describes the servers ordered by 'server create -f', in YAML or JSON
+type ServerSpecFile struct {
+	Servers []ServerSpec `json:"servers" yaml:"servers"`
+}
+
+// ServerSpec is a server to order, then to set up once started: name, private
+// networks (names or OIDs) and reverse of its IPs
+type ServerSpec struct {
+	Name        string   `json:"name" yaml:"name"`
+	Plan        string   `json:"plan" yaml:"plan"`
+	TemplateOID string   `json:"template_oid,omitempty" yaml:"template_oid,omitempty"`
+	OS          string   `json:"os,omitempty" yaml:"os,omitempty"`
+	OSVersion   string   `json:"os_version,omitempty" yaml:"os_version,omitempty"`
+	CPU         int      `json:"cpu,omitempty" yaml:"cpu,omitempty"`   // Cores
+	RAM         int      `json:"ram,omitempty" yaml:"ram,omitempty"`   // GB
+	Disk        int      `json:"disk,omitempty" yaml:"disk,omitempty"` // GB
+	SSHKeys     []string `json:"ssh_keys,omitempty" yaml:"ssh_keys,omitempty"`
+	Networks    []string `json:"networks,omitempty" yaml:"networks,omitempty"`
+	Reverse     string   `json:"reverse,omitempty" yaml:"reverse,omitempty"`
+}
+
+// ServerSpecResult is returned as JSON by 'server create -f', one per server
+type ServerSpecResult struct {
+	Name     string   `json:"name"`
+	OID      string   `json:"oid,omitempty"`
+	IPs      []string `json:"ips"`
+	Networks []string `json:"networks"`
+	Success  bool     `json:"success"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// serverSpecOrder is a validated server spec ready to be ordered
+type serverSpecOrder struct {
+	spec        ServerSpec
+	info        CreateServerInfo
+	networkOIDs []string
+}
+
+// loadServerSpecFile reads a server spec file ("-" for stdin), rejecting unknown fields
+func loadServerSpecFile(path string) (*ServerSpecFile, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	specs := &ServerSpecFile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(specs); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(specs.Servers) == 0 {
+		return nil, fmt.Errorf("%s: no server to create", path)
+	}
+	return specs, nil
+}
+
+// ServerCreateFromSpec orders the servers of a spec file, waits for them to start,
+// then names them, attaches their networks and sets the reverse of their IPs.
+// The whole file is validated before anything is ordered.
+func (run *RunMiddleware) ServerCreateFromSpec(cmd *cobra.Command) {
+	path, _ := cmd.Flags().GetString("file")
+	confirmPayment, _ := cmd.Flags().GetBool("confirm-payment")
+
+	if passwordStdin, _ := cmd.Flags().GetBool("password-stdin"); passwordStdin && path == "-" {
+		run.OutputErrorAndExit(errors.New("--password-stdin cannot be used with --file -"))
+	}
+	password, err := run.passwordFlag(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	specs, err := loadServerSpecFile(path)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	user, err := run.API.GetUserInfos()
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	companyOID := user.DefaultCompanyOID
+	if !isQuoteOnly(cmd) && !confirmPayment {
+		run.OutputErrorAndExit(errors.New("payment not confirmed: add --confirm-payment flag to proceed"))
+	}
+
+	p := &serverPreflight{run: run}
+	if !isQuoteOnly(cmd) {
+		run.preflightPayment(cmd, p, companyOID)
+	}
+	orders, err := run.validateServerSpecs(p, companyOID, specs.Servers, password)
+	if err == nil {
+		err = p.err("invalid server spec")
+	}
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if isQuoteOnly(cmd) {
+		run.printServerSpecQuotes(orders)
+		return
+	}
+
+	order, err := run.newServerOrder(cmd, companyOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	infos := make([]*CreateServerInfo, len(orders))
+	for i := range orders {
+		infos[i] = &orders[i].info
+	}
+	if err = order.checkBudget(infos); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	// Buy every server before waiting for any, then wait for all the deliveries
+	// together, each one bounded by the timeout from its own order
+	results := make([]ServerSpecResult, len(orders))
+	deliveries := make([]*serverDelivery, 0, len(orders))
+	for i, o := range orders {
+		results[i] = ServerSpecResult{Name: o.spec.Name, IPs: []string{}, Networks: []string{}}
+		if !run.JSONOutput {
+			fmt.Printf("Ordering %s (%s, %s)...\n", o.spec.Name, o.info.plan, describeResources(&orders[i].info))
+		}
+		delivery, err := order.buy(&orders[i].info)
+		if err != nil {
+			results[i].Error = err.Error()
+			// Stop ordering: the next servers would likely fail the same way
+			for j := i + 1; j < len(orders); j++ {
+				results[j] = ServerSpecResult{Name: orders[j].spec.Name, IPs: []string{}, Networks: []string{}, Error: "not ordered"}
+			}
+			break
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(deliveries) > 0 && !run.JSONOutput {
+		fmt.Println("Waiting for the servers to be delivered and started...")
+	}
+	errs := run.identifyDeliveries(companyOID, deliveries)
+	var wg sync.WaitGroup
+	for i, delivery := range deliveries {
+		if errs[i] != nil {
+			results[i].Error = errs[i].Error()
+			continue
+		}
+		results[i].OID = delivery.oid
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := run.setupSpecServer(companyOID, &orders[i], &results[i], deliveries[i].deadline); err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Success = true
+		}(i)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	if run.JSONOutput {
+		printAsJson(results)
+	} else {
+		run.printServerSpecResults(results, failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// validateServerSpecs checks every spec against the plans, templates, SSH keys,
+// networks and existing servers. The problems are added to the preflight p, to be
+// reported all together.
+func (run *RunMiddleware) validateServerSpecs(p *serverPreflight, companyOID string, specs []ServerSpec, password string) ([]serverSpecOrder, error) {
+	servers, apiReturn, err := run.API.ServerList(companyOID)
+	if err = apiCallError(apiReturn, err); err != nil {
+		return nil, err
+	}
+	networks, err := run.API.GetNetworkList(companyOID)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := &templateResolver{run: run}
+	names := map[string]bool{}
+	for _, server := range servers {
+		names[server.Name] = true
+	}
+	seen := map[string]bool{}
+	defer func() { p.label = "" }()
+
+	orders := make([]serverSpecOrder, 0, len(specs))
+	for i, spec := range specs {
+		p.label = spec.Name
+		switch {
+		case spec.Name == "":
+			p.label = fmt.Sprintf("#%d", i+1)
+			p.add("name is required")
+		case seen[spec.Name]:
+			p.add("defined twice")
+		case names[spec.Name]:
+			p.add("already exists")
+		}
+		seen[spec.Name] = true
+
+		o := serverSpecOrder{
+			spec: spec,
+			info: CreateServerInfo{
+				plan:        spec.Plan,
+				password:    password,
+				sshKeysName: normalizeSSHKeyNames(strings.Join(spec.SSHKeys, ",")),
+				quantity:    1,
+				cpu:         spec.CPU,
+				ram:         spec.RAM,
+				disk:        spec.Disk,
+			},
+		}
+		p.resources(&o.info)
+		template, err := templates.resolve(spec.TemplateOID, spec.OS, spec.OSVersion)
+		if err != nil {
+			p.add("%s", err)
+			p.sshKeys(o.info.sshKeysName)
+		} else {
+			o.info.templateOID = template.OID
+			p.checkTemplate(template)
+			p.auth(template, password, o.info.sshKeysName)
+		}
+		for _, network := range spec.Networks {
+			oid, err := findNetworkOID(networks.Networks, network)
+			if err != nil {
+				p.add("%s", err)
+				continue
+			}
+			o.networkOIDs = append(o.networkOIDs, oid)
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+func sshKeyNameExists(keys []api.SSHKey, name string) bool {
+	for _, key := range keys {
+		if key.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findNetworkOID returns the OID of a network given by OID or by unique name
+func findNetworkOID(networks []api.NetworkDetail, nameOrOID string) (string, error) {
+	var matches []string
+	for _, network := range networks {
+		if network.OID == nameOrOID {
+			return network.OID, nil
+		}
+		if network.Name == nameOrOID {
+			matches = append(matches, network.OID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("network '%s' not found", nameOrOID)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("several networks are named '%s', use its OID", nameOrOID)
+	}
+}
+
+// setupSpecServer waits for an ordered server to start, then names it, attaches
+// its networks and sets the reverse of its IPs
+func (run *RunMiddleware) setupSpecServer(companyOID string, o *serverSpecOrder, result *ServerSpecResult, deadline time.Time) error {
+	if err := run.waitStartedBefore(result.OID, deadline); err != nil {
+		return err
+	}
+	if err := apiCallError(run.API.ServerChangeName(o.spec.Name, result.OID)); err != nil {
+		return fmt.Errorf("rename failed: %w", err)
+	}
+	for i, networkOID := range o.networkOIDs {
+		if err := apiCallError(run.API.NetworkAttachServers(networkOID, []string{result.OID})); err != nil {
+			return fmt.Errorf("attach to network %s failed: %w", o.spec.Networks[i], err)
+		}
+		result.Networks = append(result.Networks, o.spec.Networks[i])
+	}
+
+	ips, err := run.API.GetCompanyIPList(companyOID)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if ip.ServerOID != result.OID {
+			continue
+		}
+		result.IPs = append(result.IPs, normalizeIP(ip.Address))
+		if o.spec.Reverse != "" && !sameHostname(ip.Reverse, o.spec.Reverse) {
+			if err = apiCallError(run.API.IPUpdateReverse(ip.OID, strings.TrimSuffix(o.spec.Reverse, "."))); err != nil {
+				return fmt.Errorf("reverse of %s failed: %w", normalizeIP(ip.Address), err)
+			}
+		}
+	}
+	return nil
+}
+
+// printServerSpecQuotes prints the price of each server of a spec file, and the total
+func (run *RunMiddleware) printServerSpecQuotes(orders []serverSpecOrder) {
+	quotes := make([]*ServerQuote, 0, len(orders))
+	var totalHT, totalTTC int64
+	for i := range orders {
+		quote, err := run.quoteServer(&orders[i].info)
+		if err != nil {
+			run.OutputErrorAndExit(fmt.Errorf("server '%s': %w", orders[i].spec.Name, err))
+		}
+		quote.Name = orders[i].spec.Name
+		quotes = append(quotes, quote)
+		totalHT += quote.HT
+		totalTTC += quote.TTC
+	}
+
+	if run.JSONOutput {
+		printAsJson(quotes)
+		return
+	}
+	for i, quote := range quotes {
+		if i > 0 {
+			fmt.Println()
+		}
+		run.printServerQuote(quote)
+	}
+	if len(quotes) > 1 {
+		fmt.Printf("\nTotal for %d servers: %s TTC (%s HT)\n", len(quotes),
+			run.Colorize(formatMoney(totalTTC, DefaultCurrency), "green"), formatMoney(totalHT, DefaultCurrency))
+	}
+}
+
+func (run *RunMiddleware) printServerSpecResults(results []ServerSpecResult, failed int) {
+	table := NewTable("NAME", "OID", "IPS", "NETWORKS", "STATUS")
+	table.SetNoColor(!run.Color)
+	for _, result := range results {
+		status := "ok"
+		var statusColorFn func(string) string
+		if !result.Success {
+			status = result.Error
+		}
+		if run.Color {
+			statusColorFn = ColorFn("green")
+			if !result.Success {
+				statusColorFn = ColorFn("red")
+			}
+		}
+		table.AddRow(
+			ColName(result.Name),
+			ColOID(result.OID),
+			ColIP(strings.Join(result.IPs, ", ")),
+			Col(strings.Join(result.Networks, ", ")),
+			ColColor(status, statusColorFn),
+		)
+	}
+	table.Print()
+
+	if failed > 0 {
+		fmt.Printf("%s %d/%d server(s) not fully created\n", run.Colorize("Error:", "red"), failed, len(results))
+	} else {
+		fmt.Printf("%s %d server(s) created\n", run.Colorize("Success:", "green"), len(results))
+	}
+}
@@ -0,0 +1,193 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// DefaultWaitTimeout is used by --wait and 'server wait' when --timeout is not set
+	DefaultWaitTimeout = 5 * time.Minute
+
+	waitInitialDelay = 2 * time.Second
+	waitMaxDelay     = 15 * time.Second
+	// waitTransitionGrace is how long we wait to see a server leave its current state
+	// (e.g. restart: started -> stopping -> starting -> started) before assuming the
+	// transition was too fast to be observed.
+	waitTransitionGrace = 30 * time.Second
+)
+
+var ErrWaitTimeout = errors.New("timeout reached while waiting for server state")
+
+// waitableStates are the steady states 'server wait --state' accepts
+var waitableStates = []string{StateStarted, StateStopped}
+
+// serverFailureStates end a wait immediately with an error
+var serverFailureStates = []string{StateDeleted, StateError, StateFailed}
+
+// ServerWaitResult is returned as JSON once the wait is over
+type ServerWaitResult struct {
+	ServerOID string `json:"server_oid"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Elapsed   string `json:"elapsed"`
+}
+
+// ServerWait blocks until a server reaches the requested state
+func (run *RunMiddleware) ServerWait(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	serverOID, _ := cmd.Flags().GetString("server-oid")
+	state, _ := cmd.Flags().GetString("state")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	state = strings.ToLower(strings.TrimSpace(state))
+	if !containsString(waitableStates, state) {
+		run.OutputErrorAndExit(fmt.Errorf("invalid state '%s': must be one of %s", state, strings.Join(waitableStates, ", ")))
+	}
+
+	run.waitAndReport(serverOID, state, timeout, false)
+}
+
+// ServerActionResult is returned as JSON by a server action run with --wait: the
+// result of the action and the result of the wait, in a single object
+type ServerActionResult struct {
+	Action interface{}       `json:"action"`
+	Wait   *ServerWaitResult `json:"wait,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// waitAndReport waits for the server state and prints the outcome.
+// Exits with a non-zero status on timeout or failure state.
+func (run *RunMiddleware) waitAndReport(serverOID, state string, timeout time.Duration, expectTransition bool) {
+	result, err := run.waitForState(serverOID, state, timeout, expectTransition)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if run.JSONOutput {
+		printAsJson(result)
+	}
+}
+
+// waitForState waits for the server state. The progress and the outcome are printed
+// in text output only.
+func (run *RunMiddleware) waitForState(serverOID, state string, timeout time.Duration, expectTransition bool) (*ServerWaitResult, error) {
+	if !run.JSONOutput {
+		fmt.Printf("Waiting for server %s to be %s (timeout %s)...\n", serverOID, state, timeout)
+	}
+
+	start := time.Now()
+	server, err := run.waitServerState(serverOID, state, timeout, expectTransition)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ServerWaitResult{
+		ServerOID: server.OID,
+		Name:      server.Name,
+		State:     state,
+		Elapsed:   time.Since(start).Round(time.Second).String(),
+	}
+	if !run.JSONOutput {
+		fmt.Printf("%s Server %s is %s (after %s)\n", run.Colorize("Success:", "green"),
+			run.Colorize(server.Name, "cyan"), GetStateColorized(run.Color, state), result.Elapsed)
+	}
+	return result, nil
+}
+
+// reportActionAndWait prints the result of an action sent to a server, printText in
+// text output and action, unless nil, in JSON, then waits for targetState when --wait is set.
+// In JSON, the action and the wait are reported as one ServerActionResult.
+func (run *RunMiddleware) reportActionAndWait(cmd *cobra.Command, serverOID string, action interface{}, printText func(), targetState string, expectTransition bool) {
+	wait, _ := cmd.Flags().GetBool("wait")
+	if !run.JSONOutput {
+		printText()
+	} else if !wait && action != nil {
+		printAsJson(action)
+	}
+	if !wait {
+		return
+	}
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	result, err := run.waitForState(serverOID, targetState, timeout, expectTransition)
+	if !run.JSONOutput {
+		if err != nil {
+			run.OutputErrorAndExit(err)
+		}
+		return
+	}
+	report := ServerActionResult{Action: action, Wait: result}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	printAsJson(report)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// waitServerState polls the server with exponential backoff until it reaches target.
+// With expectTransition, the server must first leave target (restart, reset) unless
+// no transition has been seen after waitTransitionGrace.
+func (run *RunMiddleware) waitServerState(serverOID, target string, timeout time.Duration, expectTransition bool) (*api.ServerDetail, error) {
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	delay := waitInitialDelay
+	transitioned := !expectTransition
+
+	for {
+		server, apiReturn, err := run.API.GetServerOID(serverOID)
+		if err != nil {
+			return nil, err
+		}
+		if apiReturn != nil && apiReturn.Error() {
+			return nil, apiReturn.AsError()
+		}
+
+		state := ""
+		if server.State != nil {
+			state = *server.State
+		}
+		if containsString(serverFailureStates, state) {
+			return server, fmt.Errorf("server %s entered state '%s'", serverOID, state)
+		}
+		if state != target {
+			transitioned = true
+		} else if transitioned || time.Since(start) > waitTransitionGrace {
+			return server, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return server, fmt.Errorf("%w '%s' after %s (current state: '%s')", ErrWaitTimeout, target, timeout, state)
+		}
+		if delay > remaining {
+			// Poll once more at the deadline
+			delay = remaining
+		}
+		time.Sleep(delay)
+		delay = delay * 3 / 2
+		if delay > waitMaxDelay {
+			delay = waitMaxDelay
+		}
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -17,6 +17,10 @@ const snapshotTimeFormat = "2006-01-02T15:04:05-07:00"
 func getServerIdentifier(cmd *cobra.Command) (string, bool, error) {
 	serverOID, _ := cmd.Flags().GetString("server-oid")
 	serverUUID, _ := cmd.Flags().GetString("server-uuid")
+	// 'snapshot create' accepts several --server-oid for bulk operations
+	if serverOIDs, err := cmd.Flags().GetStringSlice("server-oid"); err == nil && len(serverOIDs) > 0 {
+		serverOID = serverOIDs[0]
+	}
 
 	// Mutual exclusivity is enforced by Cobra's MarkFlagsMutuallyExclusive
 	if serverOID != "" {
@@ -98,86 +102,32 @@ func (run *RunMiddleware) SnapshotCreate(cmd *cobra.Command, args []string) {
 	_ = args
 	run.ParseGlobalFlags(cmd)
 
-	serverID, useLegacy, err := getServerIdentifier(cmd)
-	if err != nil {
-		run.OutputError(err)
-		return
-	}
-
 	forceErase, _ := cmd.Flags().GetBool("yes-i-agree-to-erase-oldest-snapshot")
 
-	// Execute query - use appropriate API version
-	var snapshot *api.SnapshotDetail
-	var apiReturn *api.Return
-
-	if useLegacy {
-		snapshot, apiReturn, err = run.API.CreateSnapshotLegacy(serverID)
-	} else {
-		snapshot, apiReturn, err = run.API.CreateSnapshot(serverID)
+	if isBulkRequest(cmd) {
+		run.runBulkOperation(cmd, "snapshot", func(server *api.ServerDetail) error {
+			_, apiReturn, err := run.createSnapshot(server.OID, false, forceErase)
+			if err != nil {
+				return err
+			}
+			if apiReturn != nil && apiReturn.Error() {
+				return apiReturn.AsError()
+			}
+			return nil
+		})
+		return
 	}
 
+	serverID, useLegacy, err := getServerIdentifier(cmd)
 	if err != nil {
 		run.OutputError(err)
 		return
 	}
 
-	// Check API error
-	if apiReturn != nil {
-		// Check if it's a limit exceeded error
-		// v2 uses error field (Title), v1 uses code field (Code)
-		isLimitExceeded := apiReturn.Title == api.SnapshotCreateErrorLimitExceeded ||
-			apiReturn.Code == api.SnapshotCreateErrorLimitExceeded
-		// API error is fatal unless it's limit exceeded and forceErase is true
-		if !(isLimitExceeded && forceErase) {
-			run.printAPIReturn(apiReturn)
-			return
-		}
-
-		// Get list of existing snapshots
-		var snapshots []api.Snapshot
-		if useLegacy {
-			snapshots, apiReturn, err = run.API.ListSnapshotsLegacy(serverID)
-		} else {
-			snapshots, apiReturn, err = run.API.ListSnapshots(serverID)
-		}
-		if err != nil || apiReturn != nil {
-			run.handleErrorAndGenericOutput(apiReturn, err)
-			return
-		}
-
-		// Find the oldest one
-		oldestSnapshot, err := getOldestSnapshotFromList(snapshots)
-		if err != nil {
-			run.OutputError(err)
-			return
-		}
-
-		// Delete oldest snapshot
-		if useLegacy {
-			// In legacy mode, use UUID field for the snapshot identifier
-			apiReturn, err = run.API.DeleteSnapshotLegacy(serverID, oldestSnapshot.UUID)
-		} else {
-			apiReturn, err = run.API.DeleteSnapshot(oldestSnapshot.OID)
-		}
-		if err != nil {
-			run.OutputError(err)
-			return
-		}
-		if apiReturn != nil && apiReturn.Error() {
-			run.printAPIReturn(apiReturn)
-			return
-		}
-
-		// Create new snapshot
-		if useLegacy {
-			snapshot, apiReturn, err = run.API.CreateSnapshotLegacy(serverID)
-		} else {
-			snapshot, apiReturn, err = run.API.CreateSnapshot(serverID)
-		}
-		if err != nil || apiReturn != nil {
-			run.handleErrorAndGenericOutput(apiReturn, err)
-			return
-		}
+	snapshot, apiReturn, err := run.createSnapshot(serverID, useLegacy, forceErase)
+	if err != nil || apiReturn != nil {
+		run.handleErrorAndGenericOutput(apiReturn, err)
+		return
 	}
 
 	// Render success output
@@ -198,6 +148,69 @@ func (run *RunMiddleware) SnapshotCreate(cmd *cobra.Command, args []string) {
 	printAsJson(snapshot)
 }
 
+// createSnapshot creates a snapshot of the server using the appropriate API version.
+// If the quota is reached and forceErase is set, the oldest snapshot is deleted first.
+func (run *RunMiddleware) createSnapshot(serverID string, useLegacy, forceErase bool) (*api.SnapshotDetail, *api.Return, error) {
+	var snapshot *api.SnapshotDetail
+	var apiReturn *api.Return
+	var err error
+
+	if useLegacy {
+		snapshot, apiReturn, err = run.API.CreateSnapshotLegacy(serverID)
+	} else {
+		snapshot, apiReturn, err = run.API.CreateSnapshot(serverID)
+	}
+	if err != nil || apiReturn == nil {
+		return snapshot, nil, err
+	}
+
+	// Check if it's a limit exceeded error
+	// v2 uses error field (Title), v1 uses code field (Code)
+	isLimitExceeded := apiReturn.Title == api.SnapshotCreateErrorLimitExceeded ||
+		apiReturn.Code == api.SnapshotCreateErrorLimitExceeded
+	// API error is fatal unless it's limit exceeded and forceErase is true
+	if !(isLimitExceeded && forceErase) {
+		return nil, apiReturn, nil
+	}
+
+	// Get list of existing snapshots
+	var snapshots []api.Snapshot
+	if useLegacy {
+		snapshots, apiReturn, err = run.API.ListSnapshotsLegacy(serverID)
+	} else {
+		snapshots, apiReturn, err = run.API.ListSnapshots(serverID)
+	}
+	if err != nil || apiReturn != nil {
+		return nil, apiReturn, err
+	}
+
+	// Find the oldest one
+	oldestSnapshot, err := getOldestSnapshotFromList(snapshots)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Delete oldest snapshot
+	if useLegacy {
+		// In legacy mode, use UUID field for the snapshot identifier
+		apiReturn, err = run.API.DeleteSnapshotLegacy(serverID, oldestSnapshot.UUID)
+	} else {
+		apiReturn, err = run.API.DeleteSnapshot(oldestSnapshot.OID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if apiReturn != nil && apiReturn.Error() {
+		return nil, apiReturn, nil
+	}
+
+	// Create new snapshot
+	if useLegacy {
+		return run.API.CreateSnapshotLegacy(serverID)
+	}
+	return run.API.CreateSnapshot(serverID)
+}
+
 func (run *RunMiddleware) SnapshotDelete(cmd *cobra.Command, args []string) {
 	// Parse flags
 	_ = args
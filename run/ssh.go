@@ -0,0 +1,247 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"titan-sc/api"
+
+	"github.com/spf13/cobra"
+)
+
+// SSHTarget is the address and login used to reach a server over SSH
+type SSHTarget struct {
+	ServerOID string `json:"server_oid"`
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	Address   string `json:"address"`
+}
+
+// SSHOptions are the local ssh client settings shared by SSH-based commands
+type SSHOptions struct {
+	Identity string   // Private key file (-i)
+	Options  []string // ssh_config options (-o KEY=VALUE)
+	Args     []string // Raw ssh arguments
+}
+
+// ServerSSH opens an SSH session on a server (or runs a command) with the local ssh client.
+// The target is given by name or OID as first argument, or by --server-oid.
+// Arguments after "--" are passed to ssh as the remote command.
+func (run *RunMiddleware) ServerSSH(cmd *cobra.Command, args []string) {
+	run.ParseGlobalFlags(cmd)
+
+	targetArgs, remoteCommand := args, []string(nil)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		targetArgs, remoteCommand = args[:dash], args[dash:]
+	}
+	if len(targetArgs) > 1 {
+		run.OutputErrorAndExit(fmt.Errorf("too many arguments: %s (use -- before the remote command)", strings.Join(targetArgs[1:], " ")))
+	}
+
+	nameOrOID, _ := cmd.Flags().GetString("server-oid")
+	if len(targetArgs) == 1 {
+		nameOrOID = targetArgs[0]
+	}
+
+	server, err := run.resolveServer(cmd, nameOrOID)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	ipv6, _ := cmd.Flags().GetBool("ipv6")
+	target, err := serverSSHTarget(server, ipv6)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if user, _ := cmd.Flags().GetString("user"); user != "" {
+		target.User = user
+	}
+
+	sshArgs := target.SSHArgs(sshOptionsFromFlags(cmd), remoteCommand)
+	if printOnly, _ := cmd.Flags().GetBool("print"); printOnly {
+		if run.JSONOutput {
+			printAsJson(map[string]interface{}{"target": target, "command": append([]string{"ssh"}, sshArgs...)})
+		} else {
+			fmt.Println("ssh " + strings.Join(sshArgs, " "))
+		}
+		return
+	}
+
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil {
+		run.OutputErrorAndExit(fmt.Errorf("ssh client not found: %w", err))
+	}
+	sshCmd := exec.Command(sshPath, sshArgs...)
+	sshCmd.Stdin = os.Stdin
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	if err = sshCmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// Propagate the exit status of ssh (or of the remote command)
+			os.Exit(exitErr.ExitCode())
+		}
+		run.OutputErrorAndExit(err)
+	}
+}
+
+// resolveServer finds a server by OID or exact name (case-insensitive) in the company
+// given by --company-oid (default company otherwise). Without any name, the user
+// picks the server interactively when possible.
+func (run *RunMiddleware) resolveServer(cmd *cobra.Command, nameOrOID string) (*api.ServerDetail, error) {
+	companyOID, err := run.GetDefaultCompanyOID(cmd)
+	if err != nil {
+		return nil, err
+	}
+	servers, apiReturn, err := run.API.ServerList(companyOID)
+	if err != nil {
+		return nil, err
+	}
+	if apiReturn != nil && apiReturn.Error() {
+		return nil, apiReturn.AsError()
+	}
+
+	if nameOrOID == "" {
+		if !run.IsInteractive() {
+			return nil, errors.New("missing server: give a server name or OID")
+		}
+		options := make([]PickerOption, 0, len(servers))
+		for _, server := range servers {
+			options = append(options, PickerOption{Value: server.OID, Description: server.Name})
+		}
+		if nameOrOID, err = run.Pick("Select server", options); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []api.ServerDetail
+	for _, server := range servers {
+		if server.OID == nameOrOID {
+			matches = []api.ServerDetail{server}
+			break
+		}
+		if strings.EqualFold(server.Name, nameOrOID) {
+			matches = append(matches, server)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("server '%s' not found in company %s", nameOrOID, companyOID)
+	case 1:
+	default:
+		var oids []string
+		for _, server := range matches {
+			oids = append(oids, server.OID)
+		}
+		return nil, fmt.Errorf("several servers are named '%s', use the OID instead: %s", nameOrOID, strings.Join(oids, ", "))
+	}
+
+	// The list may not include every detail (authentication, IPs), fetch the server
+	server, apiReturn, err := run.API.GetServerOID(matches[0].OID)
+	if err != nil {
+		return nil, err
+	}
+	if apiReturn != nil && apiReturn.Error() {
+		return nil, apiReturn.AsError()
+	}
+	return server, nil
+}
+
+// serverSSHTarget builds the SSH target of a server from its primary IP and login
+func serverSSHTarget(server *api.ServerDetail, ipv6 bool) (*SSHTarget, error) {
+	version := 4
+	if ipv6 {
+		version = 6
+	}
+	address := serverPrimaryIP(server, version)
+	if address == "" {
+		return nil, fmt.Errorf("server %s has no IPv%d address", server.Name, version)
+	}
+
+	target := &SSHTarget{ServerOID: server.OID, Name: server.Name, Address: address}
+	if server.Authentication != nil {
+		target.User = server.Authentication.UserLogin
+	}
+	return target, nil
+}
+
+// serverPrimaryIP returns the primary IP address of the given version (4 or 6),
+// or the first address of that version if none is marked primary
+func serverPrimaryIP(server *api.ServerDetail, version int) string {
+	fallback := ""
+	for _, item := range server.Items.MAC.SubItems {
+		if item.IP == nil || item.IP.Version != version {
+			continue
+		}
+		if item.Primary {
+			return item.IP.Address
+		}
+		if fallback == "" {
+			fallback = item.IP.Address
+		}
+	}
+	return fallback
+}
+
+// Destination returns the ssh destination ("user@address" or "address")
+func (t *SSHTarget) Destination() string {
+	if t.User == "" {
+		return t.Address
+	}
+	return t.User + "@" + t.Address
+}
+
+// SSHArgs returns the ssh client arguments to reach the target and run command (if any)
+func (t *SSHTarget) SSHArgs(opts SSHOptions, command []string) []string {
+	var args []string
+	if opts.Identity != "" {
+		args = append(args, "-i", opts.Identity)
+	}
+	for _, option := range opts.Options {
+		args = append(args, "-o", option)
+	}
+	args = append(args, opts.Args...)
+	args = append(args, t.Destination())
+	if len(command) > 0 {
+		args = append(args, "--")
+		args = append(args, command...)
+	}
+	return args
+}
+
+// sshOptionsFromFlags reads --identity, --option and --ssh-arg
+// hasOption tells if the ssh_config option name is set, by --option or by a raw
+// -o ssh argument
+func (o SSHOptions) hasOption(name string) bool {
+	matches := func(option string) bool {
+		key := strings.TrimSpace(option)
+		if i := strings.IndexAny(key, "= \t"); i >= 0 {
+			key = key[:i]
+		}
+		return strings.EqualFold(key, name)
+	}
+	for _, option := range o.Options {
+		if matches(option) {
+			return true
+		}
+	}
+	for i, arg := range o.Args {
+		if arg == "-o" && i+1 < len(o.Args) && matches(o.Args[i+1]) {
+			return true
+		}
+		if strings.HasPrefix(arg, "-o") && matches(arg[2:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func sshOptionsFromFlags(cmd *cobra.Command) SSHOptions {
+	var opts SSHOptions
+	opts.Identity, _ = cmd.Flags().GetString("identity")
+	opts.Options, _ = cmd.Flags().GetStringArray("option")
+	opts.Args, _ = cmd.Flags().GetStringArray("ssh-arg")
+	return opts
+}
@@ -0,0 +1,146 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultSSHConfigFile is the include file managed by 'ssh-config generate'
+const DefaultSSHConfigFile = "~/.ssh/config.d/titan"
+
+// sshConfigFileMode is the mode of a new ssh config include file, readable only by
+// its owner as ssh requires
+const sshConfigFileMode = 0600
+
+// SSHConfigResult is returned as JSON by 'ssh-config generate'
+type SSHConfigResult struct {
+	File    string   `json:"file"`
+	Hosts   int      `json:"hosts"`
+	Changed bool     `json:"changed"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// SSHConfigGenerate writes a Host entry for each server into a managed block of the
+// ssh config include file. Each company has its own block, delimited by markers:
+// the block is replaced on each run and everything outside of it is left untouched.
+func (run *RunMiddleware) SSHConfigGenerate(cmd *cobra.Command, args []string) {
+	_ = args
+	run.ParseGlobalFlags(cmd)
+	file, _ := cmd.Flags().GetString("file")
+	toStdout, _ := cmd.Flags().GetBool("stdout")
+	ipv6, _ := cmd.Flags().GetBool("ipv6")
+	identity, _ := cmd.Flags().GetString("identity")
+
+	companyOID, servers, err := run.fleetServers(cmd)
+	if err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	result := SSHConfigResult{}
+	var targets []SSHTarget
+	for i := range servers {
+		target, err := serverSSHTarget(&servers[i], ipv6)
+		if err != nil {
+			result.Skipped = append(result.Skipped, servers[i].Name)
+			continue
+		}
+		targets = append(targets, *target)
+	}
+	result.Hosts = len(targets)
+	block := renderSSHConfigBlock(companyOID, targets, serverHostnames(servers), identity)
+
+	if toStdout {
+		fmt.Print(block)
+		return
+	}
+
+	if result.File, err = expandHome(file); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+	if result.Changed, err = updateManagedFile(result.File, companyOID, block, sshConfigFileMode); err != nil {
+		run.OutputErrorAndExit(err)
+	}
+
+	if run.JSONOutput {
+		printAsJson(result)
+		return
+	}
+	for _, name := range result.Skipped {
+		fmt.Printf("%s server %s skipped: no usable IP address\n", run.Colorize("Warning:", "yellow"), name)
+	}
+	if result.Changed {
+		fmt.Printf("%s %d host(s) written to %s\n", run.Colorize("Success:", "green"), result.Hosts, result.File)
+	} else {
+		fmt.Printf("%s %s is up to date (%d host(s))\n", run.Colorize("Success:", "green"), result.File, result.Hosts)
+	}
+	if !sshConfigIncludes(result.File) {
+		fmt.Printf("Add the following line at the top of ~/.ssh/config to use these hosts:\n  Include %s\n", result.File)
+	}
+}
+
+// renderSSHConfigBlock renders the managed block, hosts sorted by name and aliased
+// by hostnames (server OID to host alias).
+// Its content only depends on the servers so that regenerating it is idempotent.
+func renderSSHConfigBlock(companyOID string, targets []SSHTarget, hostnames map[string]string, identity string) string {
+	sort.Slice(targets, func(i, j int) bool {
+		return hostnames[targets[i].ServerOID] < hostnames[targets[j].ServerOID]
+	})
+
+	begin, end := companyBlockMarkers(companyOID)
+	var b strings.Builder
+	b.WriteString(begin + "\n")
+	b.WriteString("# Managed by titan-sc ssh-config generate, manual changes inside this block are overwritten.\n")
+	for _, target := range targets {
+		fmt.Fprintf(&b, "\n# %s\nHost %s\n    HostName %s\n", target.ServerOID, hostnames[target.ServerOID], target.Address)
+		if target.User != "" {
+			fmt.Fprintf(&b, "    User %s\n", target.User)
+		}
+		if identity != "" {
+			fmt.Fprintf(&b, "    IdentityFile %s\n", identity)
+		}
+	}
+	b.WriteString(end + "\n")
+	return b.String()
+}
+
+// sshHostAlias makes a server name usable as an ssh Host pattern
+func sshHostAlias(name string) string {
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '*' || r == '?' || r == '!'
+	}), "-")
+}
+
+// sshConfigIncludes returns true if ~/.ssh/config seems to include file
+func sshConfigIncludes(file string) bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return true
+	}
+	config, err := os.ReadFile(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(config), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Include") {
+			continue
+		}
+		for _, include := range fields[1:] {
+			if include == file {
+				return true
+			}
+			if matched, _ := filepath.Match(filepath.Join(home, ".ssh", include), file); matched {
+				return true
+			}
+			if matched, _ := filepath.Match(strings.Replace(include, "~", home, 1), file); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -102,3 +102,20 @@ func (run *RunMiddleware) SSHKeyDel(cmd *cobra.Command, args []string) {
 	oid, _ := cmd.Flags().GetString("ssh-key-oid")
 	run.handleErrorAndGenericOutput(run.API.DeleteSSHKey(oid))
 }
+
+// sshKeyNames splits a comma-separated list of SSH key names, as given by
+// --ssh-keys-name. Names are trimmed and empty names are dropped.
+func sshKeyNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// normalizeSSHKeyNames returns a list of SSH key names as "name1,name2", see sshKeyNames
+func normalizeSSHKeyNames(list string) string {
+	return strings.Join(sshKeyNames(list), ",")
+}